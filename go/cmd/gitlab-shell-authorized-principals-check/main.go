@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/authorizedprincipals"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/fallback"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/executable"
+)
+
+const (
+	featureName = "gitlab-shell-authorized-principals-check"
+	rubyProgram = "gitlab-shell-authorized-principals-check-ruby"
+)
+
+// rubyExec will never return. It either replaces the current process with a
+// Ruby interpreter, or outputs an error and kills the process.
+func execRuby(rootDir string, readWriter *readwriter.ReadWriter) {
+	cmd := &fallback.Command{RootDir: rootDir, Args: os.Args, Program: rubyProgram}
+
+	if err := cmd.Execute(readWriter); err != nil {
+		fmt.Fprintf(readWriter.ErrOut, "Failed to exec: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	readWriter := &readwriter.ReadWriter{
+		Out:    os.Stdout,
+		In:     os.Stdin,
+		ErrOut: os.Stderr,
+	}
+
+	rootDir, err := executable.RootDir()
+	if err != nil {
+		fmt.Fprintln(readWriter.ErrOut, "Failed to determine root directory, exiting")
+		os.Exit(1)
+	}
+
+	config, err := config.NewFromDir(rootDir)
+	if err != nil {
+		fmt.Fprintf(readWriter.ErrOut, "Failed to read config, falling back to %s\n", rubyProgram)
+		execRuby(rootDir, readWriter)
+	}
+
+	if !config.FeatureEnabled(featureName) {
+		execRuby(rootDir, readWriter)
+	}
+
+	args, err := commandargs.ParseAuthorizedPrincipals(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(readWriter.ErrOut, err)
+		os.Exit(1)
+	}
+
+	cmd := &authorizedprincipals.Command{Config: config, Args: args}
+	if err = cmd.Execute(readWriter); err != nil {
+		fmt.Fprintln(readWriter.ErrOut, err)
+		os.Exit(1)
+	}
+}
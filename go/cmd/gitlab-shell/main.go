@@ -3,27 +3,17 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/fallback"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/executable"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/handler"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
 )
 
-// findRootDir determines the root directory (and so, the location of the config
-// file) from os.Executable()
-func findRootDir() (string, error) {
-	path, err := os.Executable()
-	if err != nil {
-		return "", err
-	}
-
-	// Start: /opt/.../gitlab-shell/bin/gitlab-shell
-	// Ends:  /opt/.../gitlab-shell
-	return filepath.Dir(filepath.Dir(path)), nil
-}
-
 // rubyExec will never return. It either replaces the current process with a
 // Ruby interpreter, or outputs an error and kills the process.
 func execRuby(rootDir string, readWriter *readwriter.ReadWriter) {
@@ -42,7 +32,7 @@ func main() {
 		ErrOut: os.Stderr,
 	}
 
-	rootDir, err := findRootDir()
+	rootDir, err := executable.RootDir()
 	if err != nil {
 		fmt.Fprintln(readWriter.ErrOut, "Failed to determine root directory, exiting")
 		os.Exit(1)
@@ -56,6 +46,10 @@ func main() {
 		execRuby(rootDir, readWriter)
 	}
 
+	logger.ProgName = "gitlab-shell"
+	// Commands still run when the log file is not writable
+	logger.Configure(config)
+
 	cmd, err := command.New(os.Args, config)
 	if err != nil {
 		// For now this could happen if `SSH_CONNECTION` is not set on
@@ -67,7 +61,25 @@ func main() {
 	// The command will write to STDOUT on execution or replace the current
 	// process in case of the `fallback.Command`
 	if err = cmd.Execute(readWriter); err != nil {
-		fmt.Fprintf(readWriter.ErrOut, "%v\n", err)
-		os.Exit(1)
+		displayError(err, readWriter)
+		os.Exit(exitCode(err))
 	}
 }
+
+func displayError(err error, readWriter *readwriter.ReadWriter) {
+	if _, ok := err.(*handler.ExitError); ok {
+		// Gitaly's own output already explains its exit code
+		return
+	}
+
+	console.DisplayError(err, readWriter.ErrOut)
+}
+
+// exitCode lets errors such as maintenance refusals pick their exit code
+func exitCode(err error) int {
+	if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+		return exitErr.ExitCode()
+	}
+
+	return 1
+}
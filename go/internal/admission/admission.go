@@ -0,0 +1,320 @@
+// Package admission caps the Git sessions of the whole host. Sessions over
+// the cap wait in a queue shared by all the gitlab-shell processes, first
+// come first served, and new ones are shed while the host is overloaded.
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/lockfile"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+const (
+	stateFile        = "state.json"
+	streamsDir       = "streams"
+	pollInterval     = 100 * time.Millisecond
+	progressInterval = 10 * time.Second
+)
+
+var (
+	ErrBusy = console.NewError("The server is too busy, please try again later")
+
+	// errWaiting keeps the state of a session still in the queue
+	errWaiting = errors.New("Waiting in the queue")
+
+	// Overridden in tests
+	timeNow         = time.Now
+	loadAverageFile = "/proc/loadavg"
+)
+
+// State is shared by all the processes in the state.json file of the
+// admission directory, which monitoring can read as well.
+type State struct {
+	NextTicket uint64   `json:"next_ticket"`
+	Waiting    []Waiter `json:"waiting"`
+	// Rejected counts the sessions refused since the file was created
+	Rejected uint64 `json:"rejected"`
+}
+
+type Waiter struct {
+	Ticket uint64 `json:"ticket"`
+	Pid    int    `json:"pid"`
+}
+
+// Controller admits sessions according to an AdmissionConfig
+type Controller struct {
+	dir              string
+	maxConcurrent    int
+	maxQueued        int
+	wait             time.Duration
+	maxLoadAverage   float64
+	maxGitalyStreams int
+}
+
+func NewController(cfg *config.AdmissionConfig) *Controller {
+	return &Controller{
+		dir:              cfg.Dir,
+		maxConcurrent:    cfg.MaxConcurrent,
+		maxQueued:        cfg.MaxQueued,
+		wait:             time.Duration(cfg.WaitSeconds) * time.Second,
+		maxLoadAverage:   cfg.MaxLoadAverage,
+		maxGitalyStreams: cfg.MaxGitalyStreams,
+	}
+}
+
+func (c *Controller) Enabled() bool {
+	return c.maxConcurrent > 0 || c.maxLoadAverage > 0 || c.maxGitalyStreams > 0
+}
+
+// Admit returns once the session may go on, telling the user on out while
+// it waits in the queue. It returns ErrBusy if the session is refused.
+func (c *Controller) Admit(out io.Writer) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return c.failOpen(err)
+	}
+
+	if reason := c.shedReason(); reason != "" {
+		return c.reject(reason)
+	}
+
+	if c.maxConcurrent <= 0 {
+		return nil
+	}
+
+	var waiter *Waiter
+	var ahead int
+	err := c.withState(func(state *State) error {
+		state.prune()
+
+		if len(state.Waiting) == 0 {
+			if acquired, err := c.acquireSlot(); err != nil || acquired {
+				return err
+			}
+		}
+
+		if len(state.Waiting) >= c.maxQueued {
+			state.Rejected++
+			return ErrBusy
+		}
+
+		waiter = &Waiter{Ticket: state.NextTicket, Pid: os.Getpid()}
+		state.NextTicket++
+		ahead = len(state.Waiting)
+		state.Waiting = append(state.Waiting, *waiter)
+
+		return nil
+	})
+
+	if err == ErrBusy {
+		return c.logRejection("queue_full")
+	} else if err != nil {
+		return c.failOpen(err)
+	} else if waiter == nil {
+		// A slot was free
+		return nil
+	}
+
+	return c.waitForSlot(waiter, ahead, out)
+}
+
+func (c *Controller) waitForSlot(waiter *Waiter, ahead int, out io.Writer) error {
+	start := timeNow()
+	deadline := start.Add(c.wait)
+	lastProgress := start
+
+	logger.Info("Queued session", map[string]interface{}{"ahead": ahead})
+	console.DisplayMessage(fmt.Sprintf("The server is busy, your session is queued at position %d...", ahead+1), out)
+
+	for {
+		time.Sleep(pollInterval)
+
+		err := c.withState(func(state *State) error {
+			state.prune()
+
+			position := state.position(waiter.Ticket)
+			if position == 0 {
+				if acquired, err := c.acquireSlot(); err != nil || acquired {
+					state.remove(waiter.Ticket)
+					return err
+				}
+			}
+
+			if !timeNow().Before(deadline) {
+				state.remove(waiter.Ticket)
+				state.Rejected++
+				return ErrBusy
+			}
+
+			ahead = position
+			return errWaiting
+		})
+
+		switch err {
+		case nil:
+			logger.Info("Admitted queued session", map[string]interface{}{"waited_ms": timeNow().Sub(start).Nanoseconds() / int64(time.Millisecond)})
+			return nil
+		case ErrBusy:
+			return c.logRejection("queue_timeout")
+		case errWaiting:
+			if timeNow().Sub(lastProgress) >= progressInterval {
+				lastProgress = timeNow()
+				console.DisplayMessage(fmt.Sprintf("Still queued at position %d...", ahead+1), out)
+			}
+		default:
+			return c.failOpen(err)
+		}
+	}
+}
+
+// acquireSlot tells whether it got one of the slots of the host, which is
+// then held until the process exits
+func (c *Controller) acquireSlot() (bool, error) {
+	slot, err := lockfile.AcquireSlot(filepath.Join(c.dir, "slot-"), c.maxConcurrent)
+	if err != nil || slot == nil {
+		return false, err
+	}
+
+	slot.HoldUntilExit()
+
+	return true, nil
+}
+
+// shedReason tells why the host is too loaded to take new sessions, if it is
+func (c *Controller) shedReason() string {
+	if c.maxLoadAverage > 0 {
+		if load, err := loadAverage(); err == nil && load > c.maxLoadAverage {
+			return "load_average"
+		}
+	}
+
+	if c.maxGitalyStreams > 0 && countStreams(filepath.Join(c.dir, streamsDir)) >= c.maxGitalyStreams {
+		return "gitaly_streams"
+	}
+
+	return ""
+}
+
+func (c *Controller) reject(reason string) error {
+	if err := c.withState(func(state *State) error {
+		state.Rejected++
+		return nil
+	}); err != nil {
+		return c.failOpen(err)
+	}
+
+	return c.logRejection(reason)
+}
+
+func (c *Controller) logRejection(reason string) error {
+	logger.Warn("Rejected session", map[string]interface{}{"reason": reason})
+
+	return ErrBusy
+}
+
+// failOpen lets sessions in when the shared state is broken
+func (c *Controller) failOpen(err error) error {
+	if err != nil {
+		logger.Warn("Failed to apply admission control", map[string]interface{}{"error": err.Error()})
+	}
+
+	return nil
+}
+
+// withState runs fn with the shared state locked, saving it afterwards. The
+// state is saved even if fn fails, unless it failed reading it.
+func (c *Controller) withState(fn func(*State) error) error {
+	file, err := os.OpenFile(filepath.Join(c.dir, stateFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	state := &State{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, state); err != nil {
+			// Start over rather than locking everyone out
+			state = &State{}
+		}
+	}
+
+	fnErr := fn(state)
+
+	if data, err = json.Marshal(state); err != nil {
+		return err
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return err
+	}
+
+	return fnErr
+}
+
+// prune drops the waiters whose process is gone
+func (s *State) prune() {
+	waiting := s.Waiting[:0]
+	for _, waiter := range s.Waiting {
+		if syscall.Kill(waiter.Pid, 0) != syscall.ESRCH {
+			waiting = append(waiting, waiter)
+		}
+	}
+
+	s.Waiting = waiting
+}
+
+// position counts the waiters ahead of ticket
+func (s *State) position(ticket uint64) int {
+	for i, waiter := range s.Waiting {
+		if waiter.Ticket == ticket {
+			return i
+		}
+	}
+
+	return len(s.Waiting)
+}
+
+func (s *State) remove(ticket uint64) {
+	if i := s.position(ticket); i < len(s.Waiting) {
+		s.Waiting = append(s.Waiting[:i], s.Waiting[i+1:]...)
+	}
+}
+
+func loadAverage() (float64, error) {
+	data, err := ioutil.ReadFile(loadAverageFile)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("Invalid %s", loadAverageFile)
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,221 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/lockfile"
+)
+
+func TestAdmit(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	controller := NewController(&config.AdmissionConfig{Dir: dir, MaxConcurrent: 1})
+	out := &bytes.Buffer{}
+
+	require.NoError(t, controller.Admit(out))
+	require.True(t, slotHeld(t, dir))
+
+	err := controller.Admit(out)
+	require.Equal(t, ErrBusy, err)
+	require.Empty(t, out.String())
+	require.Equal(t, uint64(1), readState(t, dir).Rejected)
+
+	// Like the queue progress, the refusal reads as a message from GitLab
+	console.DisplayError(err, out)
+	require.Equal(t, "> GitLab: The server is too busy, please try again later\n", out.String())
+}
+
+func TestAdmitAfterWaiting(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	slot := holdSlot(t, dir)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		slot.Unlock()
+	}()
+
+	controller := NewController(&config.AdmissionConfig{Dir: dir, MaxConcurrent: 1, MaxQueued: 1, WaitSeconds: 5})
+	out := &bytes.Buffer{}
+
+	require.NoError(t, controller.Admit(out))
+	require.True(t, slotHeld(t, dir))
+	require.Equal(t, "> GitLab: The server is busy, your session is queued at position 1...\n", out.String())
+
+	state := readState(t, dir)
+	require.Empty(t, state.Waiting)
+	require.Equal(t, uint64(1), state.NextTicket)
+	require.Equal(t, uint64(0), state.Rejected)
+}
+
+func TestAdmitTimesOut(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	slot := holdSlot(t, dir)
+	defer slot.Unlock()
+
+	controller := NewController(&config.AdmissionConfig{Dir: dir, MaxConcurrent: 1, MaxQueued: 1})
+
+	require.Equal(t, ErrBusy, controller.Admit(&bytes.Buffer{}))
+
+	state := readState(t, dir)
+	require.Empty(t, state.Waiting)
+	require.Equal(t, uint64(1), state.Rejected)
+}
+
+func TestAdmitWithFullQueue(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	slot := holdSlot(t, dir)
+	defer slot.Unlock()
+
+	writeState(t, dir, &State{NextTicket: 1, Waiting: []Waiter{{Ticket: 0, Pid: os.Getpid()}}})
+
+	controller := NewController(&config.AdmissionConfig{Dir: dir, MaxConcurrent: 1, MaxQueued: 1, WaitSeconds: 5})
+	out := &bytes.Buffer{}
+
+	require.Equal(t, ErrBusy, controller.Admit(out))
+	require.Empty(t, out.String())
+	require.Equal(t, uint64(1), readState(t, dir).Rejected)
+}
+
+func TestAdmitInOrder(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	// A waiter that is still around comes first, even with a free slot
+	writeState(t, dir, &State{NextTicket: 1, Waiting: []Waiter{{Ticket: 0, Pid: os.Getpid()}}})
+
+	controller := NewController(&config.AdmissionConfig{Dir: dir, MaxConcurrent: 1, MaxQueued: 2})
+	require.Equal(t, ErrBusy, controller.Admit(&bytes.Buffer{}))
+	require.False(t, slotHeld(t, dir))
+
+	// The waiters of processes that are gone are dropped
+	writeState(t, dir, &State{NextTicket: 1, Waiting: []Waiter{{Ticket: 0, Pid: 1 << 30}}})
+
+	require.NoError(t, controller.Admit(&bytes.Buffer{}))
+	require.True(t, slotHeld(t, dir))
+	require.Empty(t, readState(t, dir).Waiting)
+}
+
+func TestShedding(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	loadAverageFile = filepath.Join(dir, "loadavg")
+	defer func() { loadAverageFile = "/proc/loadavg" }()
+	require.NoError(t, ioutil.WriteFile(loadAverageFile, []byte("12.50 8.00 4.00 3/400 1234\n"), 0644))
+
+	controller := NewController(&config.AdmissionConfig{Dir: dir, MaxLoadAverage: 12})
+	require.Equal(t, ErrBusy, controller.Admit(&bytes.Buffer{}))
+
+	controller = NewController(&config.AdmissionConfig{Dir: dir, MaxLoadAverage: 16})
+	require.NoError(t, controller.Admit(&bytes.Buffer{}))
+
+	cfg := &config.AdmissionConfig{Dir: dir, MaxGitalyStreams: 1}
+	controller = NewController(cfg)
+
+	done := TrackStream(cfg)
+	require.Equal(t, ErrBusy, controller.Admit(&bytes.Buffer{}))
+
+	done()
+	require.NoError(t, controller.Admit(&bytes.Buffer{}))
+
+	require.Equal(t, uint64(2), readState(t, dir).Rejected)
+}
+
+func TestCountStreams(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	streams := filepath.Join(dir, streamsDir)
+	require.NoError(t, os.MkdirAll(streams, 0700))
+
+	done := TrackStream(&config.AdmissionConfig{Dir: dir, MaxGitalyStreams: 1})
+	defer done()
+
+	// Left behind by a process that crashed
+	stale := filepath.Join(streams, "1")
+	require.NoError(t, ioutil.WriteFile(stale, nil, 0600))
+
+	// Being renamed into place, or left behind by a crash once old enough
+	tmp := filepath.Join(streams, tmpPrefix+"2")
+	require.NoError(t, ioutil.WriteFile(tmp, nil, 0600))
+
+	require.Equal(t, 1, countStreams(streams))
+	require.False(t, exists(stale))
+	require.True(t, exists(tmp))
+
+	timeNow = func() time.Time { return time.Now().Add(staleTmpAge) }
+	defer func() { timeNow = time.Now }()
+
+	require.Equal(t, 1, countStreams(streams))
+	require.False(t, exists(tmp))
+}
+
+func setup(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "admission")
+	require.NoError(t, err)
+
+	return dir, func() {
+		lockfile.ReleaseHeld()
+		os.RemoveAll(dir)
+	}
+}
+
+// slotHeld tells whether the only slot of dir is taken
+func slotHeld(t *testing.T, dir string) bool {
+	slot, err := lockfile.TryLock(filepath.Join(dir, "slot-0"))
+	require.NoError(t, err)
+
+	if slot == nil {
+		return true
+	}
+
+	require.NoError(t, slot.Unlock())
+
+	return false
+}
+
+func holdSlot(t *testing.T, dir string) *lockfile.LockFile {
+	slot, err := lockfile.TryLock(filepath.Join(dir, "slot-0"))
+	require.NoError(t, err)
+	require.NotNil(t, slot)
+
+	return slot
+}
+
+func readState(t *testing.T, dir string) *State {
+	data, err := ioutil.ReadFile(filepath.Join(dir, stateFile))
+	require.NoError(t, err)
+
+	state := &State{}
+	require.NoError(t, json.Unmarshal(data, state))
+
+	return state
+}
+
+func writeState(t *testing.T, dir string, state *State) {
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, stateFile), data, 0600))
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
@@ -0,0 +1,106 @@
+package admission
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/lockfile"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+const (
+	tmpPrefix   = ".tmp-"
+	staleTmpAge = time.Minute
+)
+
+// TrackStream counts a Gitaly stream as in flight until the returned function
+// is called. Every stream holds the lock of a file of its own, so that the
+// streams of crashed processes aren't counted.
+func TrackStream(cfg *config.AdmissionConfig) func() {
+	if cfg.MaxGitalyStreams <= 0 {
+		return func() {}
+	}
+
+	dir := filepath.Join(cfg.Dir, streamsDir)
+	path := filepath.Join(dir, strconv.Itoa(os.Getpid()))
+
+	lock, err := trackStream(dir, path)
+	if err != nil {
+		logger.Warn("Failed to track the Gitaly stream", map[string]interface{}{"error": err.Error()})
+		return func() {}
+	}
+
+	return func() {
+		os.Remove(path)
+		lock.Unlock()
+	}
+}
+
+// trackStream locks a temporary file before renaming it to path, so that
+// countStreams never sees the file of a stream unlocked
+func trackStream(dir, path string) (*lockfile.LockFile, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	tmpPath := filepath.Join(dir, tmpPrefix+filepath.Base(path))
+
+	lock, err := lockfile.TryLock(tmpPath)
+	if err != nil {
+		return nil, err
+	} else if lock == nil {
+		return nil, fmt.Errorf("%s is locked", tmpPath)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		lock.Unlock()
+
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// countStreams counts the locked stream files of dir, removing the others.
+// Temporary files are only removed once they are old enough not to belong to
+// a stream being tracked.
+func countStreams(dir string) int {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, file := range files {
+		isTmp := strings.HasPrefix(file.Name(), tmpPrefix)
+		if isTmp && timeNow().Sub(file.ModTime()) < staleTmpAge {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+
+		lock, err := lockfile.TryLock(path)
+		if err != nil {
+			continue
+		}
+
+		if lock == nil {
+			if !isTmp {
+				count++
+			}
+			continue
+		}
+
+		os.Remove(path)
+		lock.Unlock()
+	}
+
+	return count
+}
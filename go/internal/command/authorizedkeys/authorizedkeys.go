@@ -0,0 +1,134 @@
+package authorizedkeys
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/keyindex"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/sshkey"
+)
+
+type Command struct {
+	Config *config.Config
+	Args   *commandargs.AuthorizedKeys
+}
+
+func (c *Command) Execute(readWriter *readwriter.ReadWriter) error {
+	// Only check access if the requested username matches the configured username.
+	if !c.Args.Matches() {
+		return nil
+	}
+
+	if c.Args.ByFingerprint() {
+		if c.Args.KeyType == "" || c.Args.Fingerprint == "" {
+			return errors.New("# No key provided")
+		}
+
+		if !strings.HasPrefix(c.Args.Fingerprint, sshkey.FingerprintPrefix) {
+			return errors.New("# Only SHA256 fingerprints are supported")
+		}
+	} else if c.Args.Key == "" {
+		return errors.New("# No key provided")
+	}
+
+	if line, found := c.lookupIndex(); found {
+		fmt.Fprintln(readWriter.Out, line)
+		return nil
+	}
+
+	response, err := c.getAuthorizedKey()
+	if err != nil || response == nil {
+		fmt.Fprintf(readWriter.Out, "# No key was found for %s\n", c.lookupKey())
+		return nil
+	}
+
+	keyLine, err := response.KeyLine(c.Config.RootDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(readWriter.Out, keyLine.ToString())
+
+	return nil
+}
+
+// lookupIndex finds the line of the key in the index kept by gitlab-keys. The
+// API is asked about anything the index can't answer, including everything
+// once auth_file changed since the index was built.
+func (c *Command) lookupIndex() (string, bool) {
+	if !c.Config.AuthorizedKeysIndex.Enabled {
+		return "", false
+	}
+
+	index, err := keyindex.Open(c.Config.AuthorizedKeysIndex.Path)
+	if err != nil {
+		return "", false
+	}
+	defer index.Close()
+
+	if fresh, err := index.Fresh(c.Config.AuthFile); err != nil || !fresh {
+		return "", false
+	}
+
+	line, found, err := index.Get(c.lookupKey())
+	if err != nil {
+		return "", false
+	}
+
+	return line, found
+}
+
+func (c *Command) getAuthorizedKey() (*authorizedkeys.Response, error) {
+	client, err := authorizedkeys.NewClient(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := func() (*authorizedkeys.Response, error) {
+		var response *authorizedkeys.Response
+		var err error
+
+		if c.Args.ByFingerprint() {
+			response, err = client.GetByFingerprint(c.Args.KeyType, c.Args.Fingerprint)
+		} else {
+			response, err = client.GetByKey(c.Args.Key)
+		}
+
+		if apiError, ok := err.(*gitlabnet.ApiError); ok && apiError.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+
+		return response, err
+	}
+
+	cacheConfig := c.Config.AuthorizedKeysCache
+	if !cacheConfig.Enabled {
+		return lookup()
+	}
+
+	cache := &cache{
+		dir:         cacheConfig.Dir,
+		ttl:         time.Duration(cacheConfig.TtlSeconds) * time.Second,
+		negativeTtl: time.Duration(cacheConfig.NegativeTtlSeconds) * time.Second,
+	}
+
+	return cache.fetch(c.lookupKey(), lookup)
+}
+
+// lookupKey is what identifies the key, its fingerprint or the key itself.
+// They can't be confused with each other since base64 has no ':'.
+func (c *Command) lookupKey() string {
+	if c.Args.ByFingerprint() {
+		return c.Args.Fingerprint
+	}
+
+	return c.Args.Key
+}
@@ -0,0 +1,254 @@
+package authorizedkeys
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/keyindex"
+)
+
+var (
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/authorized_keys",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("fingerprint") == "SHA256:fingerprint" && r.URL.Query().Get("key_type") == "ssh-rsa" {
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": 3, "key": "ssh-rsa AAAA"})
+					return
+				}
+
+				switch r.URL.Query().Get("key") {
+				case "key":
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": 1, "key": "public-key"})
+				case "restricted-key":
+					json.NewEncoder(w).Encode(map[string]interface{}{"id": 2, "key": "restricted-key", "from": []string{"10.0.0.0/8"}, "expires_at": "2030-01-01T00:00:00Z"})
+				case "broken":
+					w.WriteHeader(http.StatusInternalServerError)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			},
+		},
+	}
+)
+
+func TestExecute(t *testing.T) {
+	url, cleanup := setup(t)
+	defer cleanup()
+
+	cacheDir, err := ioutil.TempDir("", "authorized-keys-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	testCases := []struct {
+		desc           string
+		arguments      *commandargs.AuthorizedKeys
+		cache          config.AuthorizedKeysCacheConfig
+		expectedOutput string
+	}{
+		{
+			desc:           "With matching username and key",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "key"},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key\n",
+		},
+		{
+			desc:           "With matching username and key through the cache",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "key"},
+			cache:          config.AuthorizedKeysCacheConfig{Enabled: true, Dir: cacheDir, TtlSeconds: 60, NegativeTtlSeconds: 10},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key\n",
+		},
+		{
+			desc:           "With restrictions on the key",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "restricted-key"},
+			cache:          config.AuthorizedKeysCacheConfig{Enabled: true, Dir: cacheDir, TtlSeconds: 60, NegativeTtlSeconds: 10},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-2\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty,from=\"10.0.0.0/8\",expiry-time=\"20300101000000Z\" restricted-key\n",
+		},
+		{
+			desc:           "With a fingerprint",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", KeyType: "ssh-rsa", Fingerprint: "SHA256:fingerprint"},
+			cache:          config.AuthorizedKeysCacheConfig{Enabled: true, Dir: cacheDir, TtlSeconds: 60, NegativeTtlSeconds: 10},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-3\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa AAAA\n",
+		},
+		{
+			desc:           "When the fingerprint doesn't match any existing key",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", KeyType: "ssh-ed25519", Fingerprint: "SHA256:fingerprint"},
+			expectedOutput: "# No key was found for SHA256:fingerprint\n",
+		},
+		{
+			desc:           "When key doesn't match any existing key",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "not-found"},
+			expectedOutput: "# No key was found for not-found\n",
+		},
+		{
+			desc:           "When the API fails",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "broken"},
+			cache:          config.AuthorizedKeysCacheConfig{Enabled: true, Dir: cacheDir, TtlSeconds: 60, NegativeTtlSeconds: 10},
+			expectedOutput: "# No key was found for broken\n",
+		},
+		{
+			desc:           "When the usernames don't match",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "other", Key: "key"},
+			expectedOutput: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			cmd := &Command{
+				Config: &config.Config{RootDir: "/tmp", GitlabUrl: url, AuthorizedKeysCache: tc.cache},
+				Args:   tc.arguments,
+			}
+
+			err := cmd.Execute(&readwriter.ReadWriter{Out: buffer})
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedOutput, buffer.String())
+		})
+	}
+}
+
+func TestExecuteWithoutKey(t *testing.T) {
+	cmd := &Command{
+		Config: &config.Config{RootDir: "/tmp"},
+		Args:   &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user"},
+	}
+
+	err := cmd.Execute(&readwriter.ReadWriter{Out: &bytes.Buffer{}})
+	require.EqualError(t, err, "# No key provided")
+}
+
+func TestExecuteWithInvalidFingerprint(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		arguments     *commandargs.AuthorizedKeys
+		expectedError string
+	}{
+		{
+			desc:          "Without a key type",
+			arguments:     &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Fingerprint: "SHA256:fingerprint"},
+			expectedError: "# No key provided",
+		},
+		{
+			desc:          "With an MD5 fingerprint",
+			arguments:     &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", KeyType: "ssh-rsa", Fingerprint: "MD5:00:11:22"},
+			expectedError: "# Only SHA256 fingerprints are supported",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{Config: &config.Config{RootDir: "/tmp"}, Args: tc.arguments}
+
+			err := cmd.Execute(&readwriter.ReadWriter{Out: &bytes.Buffer{}})
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestExecuteWithIndex(t *testing.T) {
+	url, cleanup := setup(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "authorized-keys-index")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	indexPath := filepath.Join(dir, "authorized_keys.index")
+	indexedLine := `command="/tmp/bin/gitlab-shell key-7",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-ed25519 indexed-key`
+
+	authFile := filepath.Join(dir, "authorized_keys")
+	require.NoError(t, ioutil.WriteFile(authFile, []byte(indexedLine+"\n"), 0600))
+	authFileInfo, err := os.Stat(authFile)
+	require.NoError(t, err)
+
+	writer, err := keyindex.Create(indexPath)
+	require.NoError(t, err)
+	require.NoError(t, writer.SetSource(authFileInfo))
+	require.NoError(t, writer.Add("indexed-key", indexedLine))
+	require.NoError(t, writer.Add("SHA256:indexed", indexedLine))
+	require.NoError(t, writer.Commit())
+
+	staleAuthFile := filepath.Join(dir, "stale_authorized_keys")
+	require.NoError(t, ioutil.WriteFile(staleAuthFile, []byte(indexedLine+"\n"), 0600))
+
+	testCases := []struct {
+		desc           string
+		arguments      *commandargs.AuthorizedKeys
+		indexPath      string
+		authFile       string
+		expectedOutput string
+	}{
+		{
+			desc:           "When the key is in the index",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "indexed-key"},
+			indexPath:      indexPath,
+			authFile:       authFile,
+			expectedOutput: indexedLine + "\n",
+		},
+		{
+			desc:           "When the fingerprint is in the index",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", KeyType: "ssh-ed25519", Fingerprint: "SHA256:indexed"},
+			indexPath:      indexPath,
+			authFile:       authFile,
+			expectedOutput: indexedLine + "\n",
+		},
+		{
+			desc:           "When the key is not in the index",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "key"},
+			indexPath:      indexPath,
+			authFile:       authFile,
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty public-key\n",
+		},
+		{
+			desc:           "When the index is missing",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "indexed-key"},
+			indexPath:      filepath.Join(dir, "missing.index"),
+			authFile:       authFile,
+			expectedOutput: "# No key was found for indexed-key\n",
+		},
+		{
+			desc:           "When the index was built from another version of auth_file",
+			arguments:      &commandargs.AuthorizedKeys{ExpectedUser: "user", ActualUser: "user", Key: "indexed-key"},
+			indexPath:      indexPath,
+			authFile:       staleAuthFile,
+			expectedOutput: "# No key was found for indexed-key\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			cmd := &Command{
+				Config: &config.Config{
+					RootDir:             "/tmp",
+					GitlabUrl:           url,
+					AuthFile:            tc.authFile,
+					AuthorizedKeysIndex: config.AuthorizedKeysIndexConfig{Enabled: true, Path: tc.indexPath},
+				},
+				Args: tc.arguments,
+			}
+
+			require.NoError(t, cmd.Execute(&readwriter.ReadWriter{Out: buffer}))
+			require.Equal(t, tc.expectedOutput, buffer.String())
+		})
+	}
+}
+
+func setup(t *testing.T) (string, func()) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+
+	return url, cleanup
+}
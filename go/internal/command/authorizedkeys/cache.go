@@ -0,0 +1,184 @@
+package authorizedkeys
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedkeys"
+)
+
+const (
+	// pruneStamp is touched whenever the cache is pruned, so that it happens
+	// at most once every pruneInterval
+	pruneStamp    = ".pruned"
+	pruneInterval = 10 * time.Minute
+)
+
+var (
+	// timeNow is overridden in tests
+	timeNow = time.Now
+)
+
+// lookupFunc asks the API about a key. A nil response without an error means
+// the key is unknown.
+type lookupFunc func() (*authorizedkeys.Response, error)
+
+// cache keeps the result of every lookup in a file of its own, named after a
+// digest of the key. Entries are guarded by flock(2), so that the sshd
+// children looking up the same key share a single API call.
+type cache struct {
+	dir         string
+	ttl         time.Duration
+	negativeTtl time.Duration
+}
+
+type cacheEntry struct {
+	Found     bool                     `json:"found"`
+	Response  *authorizedkeys.Response `json:"response,omitempty"`
+	ExpiresAt int64                    `json:"expires_at"`
+}
+
+func (c *cache) fetch(key string, lookup lookupFunc) (*authorizedkeys.Response, error) {
+	file, err := c.open(key)
+	if err != nil {
+		// A broken cache must not lock anyone out
+		return lookup()
+	}
+	defer file.Close()
+
+	fd := int(file.Fd())
+
+	if err := syscall.Flock(fd, syscall.LOCK_SH); err != nil {
+		return lookup()
+	}
+
+	if entry := c.read(file); entry != nil {
+		return entry.response(), nil
+	}
+
+	// Converting the lock isn't atomic, another process may have refreshed the
+	// entry in the meantime.
+	if err := syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return lookup()
+	}
+
+	if entry := c.read(file); entry != nil {
+		return entry.response(), nil
+	}
+
+	response, err := lookup()
+	if err != nil {
+		// Only definitive answers are cached
+		return nil, err
+	}
+
+	c.write(file, response)
+	c.prune()
+
+	return response, nil
+}
+
+func (c *cache) open(key string) (*os.File, error) {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(key))
+	path := filepath.Join(c.dir, hex.EncodeToString(digest[:]))
+
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+}
+
+// read returns the entry stored in file, unless it is missing, unreadable or
+// expired.
+func (c *cache) read(file *os.File) *cacheEntry {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+
+	entry := &cacheEntry{}
+	if err := json.NewDecoder(file).Decode(entry); err != nil {
+		return nil
+	}
+
+	if timeNow().Unix() >= entry.ExpiresAt {
+		return nil
+	}
+
+	return entry
+}
+
+func (c *cache) write(file *os.File, response *authorizedkeys.Response) {
+	entry := &cacheEntry{ExpiresAt: timeNow().Add(c.negativeTtl).Unix()}
+	if response != nil {
+		entry = &cacheEntry{Found: true, Response: response, ExpiresAt: timeNow().Add(c.ttl).Unix()}
+	}
+
+	if err := file.Truncate(0); err != nil {
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	json.NewEncoder(file).Encode(entry)
+}
+
+// prune removes the expired entries, so that the directory doesn't keep one
+// for every key ever looked up. Entries being used are left alone.
+func (c *cache) prune() {
+	stamp := filepath.Join(c.dir, pruneStamp)
+	now := timeNow()
+
+	if info, err := os.Stat(stamp); err == nil && now.Sub(info.ModTime()) < pruneInterval {
+		return
+	}
+
+	if err := ioutil.WriteFile(stamp, nil, 0600); err != nil {
+		return
+	}
+	os.Chtimes(stamp, now, now)
+
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	for _, info := range infos {
+		if info.Mode().IsRegular() && info.Name() != pruneStamp {
+			c.pruneEntry(filepath.Join(c.dir, info.Name()))
+		}
+	}
+}
+
+func (c *cache) pruneEntry(path string) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return
+	}
+
+	if c.read(file) == nil {
+		os.Remove(path)
+	}
+}
+
+func (e *cacheEntry) response() *authorizedkeys.Response {
+	if !e.Found {
+		return nil
+	}
+
+	return e.Response
+}
@@ -0,0 +1,170 @@
+package authorizedkeys
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedkeys"
+)
+
+type countingLookup struct {
+	calls    int32
+	response *authorizedkeys.Response
+	err      error
+}
+
+func (l *countingLookup) lookup() (*authorizedkeys.Response, error) {
+	atomic.AddInt32(&l.calls, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return l.response, l.err
+}
+
+func setupCache(t *testing.T) (*cache, func()) {
+	dir, err := ioutil.TempDir("", "authorized-keys-cache")
+	require.NoError(t, err)
+
+	return &cache{dir: dir, ttl: time.Minute, negativeTtl: 10 * time.Second}, func() { os.RemoveAll(dir) }
+}
+
+func freezeTime(now time.Time) func() {
+	oldTimeNow := timeNow
+	timeNow = func() time.Time { return now }
+
+	return func() { timeNow = oldTimeNow }
+}
+
+func TestCacheStoresFoundKeys(t *testing.T) {
+	cache, cleanup := setupCache(t)
+	defer cleanup()
+
+	now := time.Now()
+	defer freezeTime(now)()
+
+	l := &countingLookup{response: &authorizedkeys.Response{Id: 1, Key: "public-key", From: []string{"10.0.0.0/8"}, Restrict: true}}
+
+	for i := 0; i < 3; i++ {
+		response, err := cache.fetch("key", l.lookup)
+		require.NoError(t, err)
+		require.Equal(t, l.response, response)
+	}
+	require.Equal(t, int32(1), l.calls)
+
+	defer freezeTime(now.Add(time.Minute))()
+
+	_, err := cache.fetch("key", l.lookup)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), l.calls)
+}
+
+func TestCacheStoresUnknownKeys(t *testing.T) {
+	cache, cleanup := setupCache(t)
+	defer cleanup()
+
+	now := time.Now()
+	defer freezeTime(now)()
+
+	l := &countingLookup{}
+
+	for i := 0; i < 3; i++ {
+		response, err := cache.fetch("unknown", l.lookup)
+		require.NoError(t, err)
+		require.Nil(t, response)
+	}
+	require.Equal(t, int32(1), l.calls)
+
+	defer freezeTime(now.Add(10 * time.Second))()
+
+	_, err := cache.fetch("unknown", l.lookup)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), l.calls)
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	cache, cleanup := setupCache(t)
+	defer cleanup()
+
+	l := &countingLookup{err: errors.New("Internal API unreachable")}
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.fetch("key", l.lookup)
+		require.EqualError(t, err, "Internal API unreachable")
+	}
+	require.Equal(t, int32(2), l.calls)
+}
+
+func TestCacheSharesConcurrentLookups(t *testing.T) {
+	cache, cleanup := setupCache(t)
+	defer cleanup()
+
+	l := &countingLookup{response: &authorizedkeys.Response{Id: 1, Key: "public-key"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			response, err := cache.fetch("key", l.lookup)
+			require.NoError(t, err)
+			require.Equal(t, l.response, response)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), l.calls)
+}
+
+func TestCacheFallsBackToLookup(t *testing.T) {
+	cache := &cache{dir: "/proc/does/not/exist", ttl: time.Minute}
+	l := &countingLookup{response: &authorizedkeys.Response{Id: 1, Key: "public-key"}}
+
+	response, err := cache.fetch("key", l.lookup)
+	require.NoError(t, err)
+	require.Equal(t, l.response, response)
+}
+
+func TestCachePrunesExpiredEntries(t *testing.T) {
+	cache, cleanup := setupCache(t)
+	defer cleanup()
+
+	now := time.Now()
+	restoreTime := freezeTime(now)
+
+	l := &countingLookup{response: &authorizedkeys.Response{Id: 1, Key: "public-key"}}
+	for _, key := range []string{"first", "second"} {
+		_, err := cache.fetch(key, l.lookup)
+		require.NoError(t, err)
+	}
+	restoreTime()
+
+	// The stamp of the last prune is there along with the two entries
+	requireEntries(t, cache, 3)
+
+	defer freezeTime(now.Add(time.Minute))()
+	_, err := cache.fetch("fresh", l.lookup)
+	require.NoError(t, err)
+
+	// Pruning waits for pruneInterval
+	requireEntries(t, cache, 4)
+
+	defer freezeTime(now.Add(pruneInterval))()
+	_, err = cache.fetch("new", l.lookup)
+	require.NoError(t, err)
+
+	// Only the stamp and the new entry are left
+	requireEntries(t, cache, 2)
+}
+
+func requireEntries(t *testing.T, cache *cache, count int) {
+	infos, err := ioutil.ReadDir(cache.dir)
+	require.NoError(t, err)
+	require.Len(t, infos, count)
+}
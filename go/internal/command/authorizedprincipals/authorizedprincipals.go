@@ -0,0 +1,68 @@
+package authorizedprincipals
+
+import (
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedprincipals"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/keyline"
+)
+
+type Command struct {
+	Config *config.Config
+	Args   *commandargs.AuthorizedPrincipals
+}
+
+func (c *Command) Execute(readWriter *readwriter.ReadWriter) error {
+	principals, err := c.authorizedPrincipals()
+	if err != nil {
+		return err
+	}
+
+	for _, principal := range principals {
+		keyLine, err := keyline.NewPrincipalKeyLine(c.Args.KeyId, principal, c.Config.RootDir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(readWriter.Out, keyLine.ToString())
+	}
+
+	return nil
+}
+
+// authorizedPrincipals returns the principals given on the command line,
+// filtered by the API when validation is enabled. A failing API authorizes
+// nothing.
+func (c *Command) authorizedPrincipals() ([]string, error) {
+	if !c.Config.AuthorizedPrincipals.Validate {
+		return c.Args.Principals, nil
+	}
+
+	client, err := authorizedprincipals.NewClient(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Validate(c.Args.KeyId, c.Args.Principals)
+	if err != nil {
+		return nil, fmt.Errorf("# Failed to validate principals: %v", err)
+	}
+
+	// Only keep principals that were asked for, in the order they were given
+	allowed := make(map[string]bool)
+	for _, principal := range response.Principals {
+		allowed[principal] = true
+	}
+
+	var principals []string
+	for _, principal := range c.Args.Principals {
+		if allowed[principal] {
+			principals = append(principals, principal)
+		}
+	}
+
+	return principals, nil
+}
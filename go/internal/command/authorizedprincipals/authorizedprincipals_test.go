@@ -0,0 +1,102 @@
+package authorizedprincipals
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedprincipals"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/authorized_principals",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *authorizedprincipals.Request
+				json.NewDecoder(r.Body).Decode(&request)
+
+				switch request.KeyId {
+				case "active-user":
+					json.NewEncoder(w).Encode(&authorizedprincipals.Response{Principals: []string{"admins", "sshUsers", "unknown"}})
+				case "blocked-user":
+					json.NewEncoder(w).Encode(&authorizedprincipals.Response{Principals: []string{}})
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+)
+
+func TestExecute(t *testing.T) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	testCases := []struct {
+		desc           string
+		arguments      *commandargs.AuthorizedPrincipals
+		validate       bool
+		expectedOutput string
+	}{
+		{
+			desc:      "Without validation",
+			arguments: &commandargs.AuthorizedPrincipals{KeyId: "blocked-user", Principals: []string{"sshUsers", "admins"}},
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell username-blocked-user\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty sshUsers\n" +
+				"command=\"/tmp/bin/gitlab-shell username-blocked-user\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty admins\n",
+		},
+		{
+			desc:      "With validation for an active user",
+			arguments: &commandargs.AuthorizedPrincipals{KeyId: "active-user", Principals: []string{"sshUsers", "admins", "others"}},
+			validate:  true,
+			expectedOutput: "command=\"/tmp/bin/gitlab-shell username-active-user\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty sshUsers\n" +
+				"command=\"/tmp/bin/gitlab-shell username-active-user\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty admins\n",
+		},
+		{
+			desc:           "With validation for a blocked user",
+			arguments:      &commandargs.AuthorizedPrincipals{KeyId: "blocked-user", Principals: []string{"sshUsers"}},
+			validate:       true,
+			expectedOutput: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			cmd := &Command{
+				Config: &config.Config{RootDir: "/tmp", GitlabUrl: url, AuthorizedPrincipals: config.AuthorizedPrincipalsConfig{Validate: tc.validate}},
+				Args:   tc.arguments,
+			}
+
+			err := cmd.Execute(&readwriter.ReadWriter{Out: buffer})
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedOutput, buffer.String())
+		})
+	}
+}
+
+func TestFailingValidation(t *testing.T) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	buffer := &bytes.Buffer{}
+	cmd := &Command{
+		Config: &config.Config{RootDir: "/tmp", GitlabUrl: url, AuthorizedPrincipals: config.AuthorizedPrincipalsConfig{Validate: true}},
+		Args:   &commandargs.AuthorizedPrincipals{KeyId: "broken", Principals: []string{"sshUsers"}},
+	}
+
+	err = cmd.Execute(&readwriter.ReadWriter{Out: buffer})
+
+	require.EqualError(t, err, "# Failed to validate principals: Internal API error (500)")
+	require.Empty(t, buffer.String())
+}
@@ -1,12 +1,23 @@
 package command
 
 import (
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/admission"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/discover"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/fallback"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/lfsauthenticate"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/lfstransfer"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/receivepack"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/twofactorrecover"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/uploadarchive"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/uploadpack"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/maintenance"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/ratelimit"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/sshaccess"
 )
 
 type Command interface {
@@ -20,11 +31,64 @@ func New(arguments []string, config *config.Config) (Command, error) {
 		return nil, err
 	}
 
+	if remoteIp := args.SshConnection.RemoteIp; remoteIp != "" {
+		logger.SetSessionFields(map[string]interface{}{"remote_ip": remoteIp})
+	}
+
+	// The policy applies to the Ruby implementation as well
+	if err := sshaccess.Check(config, args); err != nil {
+		return &errorCommand{err: err}, nil
+	}
+
+	// Checked right after parsing, commandargs.Parse has no configuration.
+	// Unknown commands are rejected by either implementation anyway.
+	if args.CommandType != "" && !config.CommandEnabled(string(args.CommandType)) {
+		logger.Warn("Denied disabled command", map[string]interface{}{"command": args.SshCommand, "command_type": string(args.CommandType)})
+		return &errorCommand{err: console.NewError(config.Commands.DisabledMessage)}, nil
+	}
+
+	if err := maintenance.Check(config, args); err != nil {
+		return &errorCommand{err: err}, nil
+	}
+
+	if err := ratelimit.Check(config, args); err != nil {
+		return &errorCommand{err: err}, nil
+	}
+
+	var cmd Command = &fallback.Command{RootDir: config.RootDir, Args: arguments}
 	if config.FeatureEnabled(string(args.CommandType)) {
-		return buildCommand(args, config), nil
+		cmd = buildCommand(args, config)
+	}
+
+	// Queued sessions are told about it, which needs the command's output
+	if controller := admission.NewController(&config.Admission); controller.Enabled() && args.CommandType.IsGitOperation() {
+		cmd = &admittedCommand{Command: cmd, controller: controller}
+	}
+
+	return cmd, nil
+}
+
+// errorCommand fails with err, which is shown to the user
+type errorCommand struct {
+	err error
+}
+
+func (c *errorCommand) Execute(*readwriter.ReadWriter) error {
+	return c.err
+}
+
+// admittedCommand runs Command once admission control lets it
+type admittedCommand struct {
+	Command
+	controller *admission.Controller
+}
+
+func (c *admittedCommand) Execute(readWriter *readwriter.ReadWriter) error {
+	if err := c.controller.Admit(readWriter.ErrOut); err != nil {
+		return err
 	}
 
-	return &fallback.Command{RootDir: config.RootDir, Args: arguments}, nil
+	return c.Command.Execute(readWriter)
 }
 
 func buildCommand(args *commandargs.CommandArgs, config *config.Config) Command {
@@ -33,6 +97,16 @@ func buildCommand(args *commandargs.CommandArgs, config *config.Config) Command
 		return &discover.Command{Config: config, Args: args}
 	case commandargs.TwoFactorRecover:
 		return &twofactorrecover.Command{Config: config, Args: args}
+	case commandargs.ReceivePack:
+		return &receivepack.Command{Config: config, Args: args}
+	case commandargs.UploadPack:
+		return &uploadpack.Command{Config: config, Args: args}
+	case commandargs.UploadArchive:
+		return &uploadarchive.Command{Config: config, Args: args}
+	case commandargs.LfsAuthenticate:
+		return &lfsauthenticate.Command{Config: config, Args: args}
+	case commandargs.LfsTransfer:
+		return &lfstransfer.Command{Config: config, Args: args}
 	}
 
 	return nil
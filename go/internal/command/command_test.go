@@ -6,8 +6,16 @@ import (
 	"github.com/stretchr/testify/assert"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/discover"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/fallback"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/lfsauthenticate"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/lfstransfer"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/receivepack"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/twofactorrecover"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/uploadarchive"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/uploadpack"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/maintenance"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/testhelper"
 )
 
@@ -58,6 +66,84 @@ func TestNew(t *testing.T) {
 			},
 			expectedType: &twofactorrecover.Command{},
 		},
+		{
+			desc:      "it returns a ReceivePack command if the feature is enabled",
+			arguments: []string{},
+			config: &config.Config{
+				GitlabUrl: "http+unix://gitlab.socket",
+				Migration: config.MigrationConfig{Enabled: true, Features: []string{"git-receive-pack"}},
+			},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-receive-pack 'group/repo'",
+			},
+			expectedType: &receivepack.Command{},
+		},
+		{
+			desc:      "it returns an UploadPack command if the feature is enabled",
+			arguments: []string{},
+			config: &config.Config{
+				GitlabUrl: "http+unix://gitlab.socket",
+				Migration: config.MigrationConfig{Enabled: true, Features: []string{"git-upload-pack"}},
+			},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-upload-pack 'group/repo'",
+			},
+			expectedType: &uploadpack.Command{},
+		},
+		{
+			desc:      "it returns an UploadArchive command if the feature is enabled",
+			arguments: []string{},
+			config: &config.Config{
+				GitlabUrl: "http+unix://gitlab.socket",
+				Migration: config.MigrationConfig{Enabled: true, Features: []string{"git-upload-archive"}},
+			},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-upload-archive 'group/repo'",
+			},
+			expectedType: &uploadarchive.Command{},
+		},
+		{
+			desc:      "it returns a LfsAuthenticate command if the feature is enabled",
+			arguments: []string{},
+			config: &config.Config{
+				GitlabUrl: "http+unix://gitlab.socket",
+				Migration: config.MigrationConfig{Enabled: true, Features: []string{"git-lfs-authenticate"}},
+			},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-lfs-authenticate 'group/repo' download",
+			},
+			expectedType: &lfsauthenticate.Command{},
+		},
+		{
+			desc:      "it returns a LfsTransfer command if the feature is enabled",
+			arguments: []string{},
+			config: &config.Config{
+				GitlabUrl: "http+unix://gitlab.socket",
+				Migration: config.MigrationConfig{Enabled: true, Features: []string{"git-lfs-transfer"}},
+			},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-lfs-transfer 'group/repo' upload",
+			},
+			expectedType: &lfstransfer.Command{},
+		},
+		{
+			desc:      "it returns a Fallback command if the git feature is not enabled",
+			arguments: []string{},
+			config: &config.Config{
+				GitlabUrl: "http+unix://gitlab.socket",
+				Migration: config.MigrationConfig{Enabled: true, Features: []string{"git-upload-pack"}},
+			},
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-receive-pack 'group/repo'",
+			},
+			expectedType: &fallback.Command{},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -73,6 +159,118 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNewDeniedBySshAccess(t *testing.T) {
+	restoreEnv := testhelper.TempEnv(map[string]string{
+		"SSH_CONNECTION":       "192.168.1.10 51234 10.0.0.1 22",
+		"SSH_ORIGINAL_COMMAND": "git-receive-pack 'group/repo'",
+	})
+	defer restoreEnv()
+
+	cfg := &config.Config{
+		GitlabUrl: "http+unix://gitlab.socket",
+		SshAccess: config.SshAccessConfig{IpRulesConfig: config.IpRulesConfig{Allow: []string{"10.0.0.0/8"}}},
+	}
+
+	command, err := New([]string{}, cfg)
+	assert.NoError(t, err)
+
+	err = command.Execute(&readwriter.ReadWriter{})
+	assert.EqualError(t, err, "SSH access from 192.168.1.10 is not allowed")
+}
+
+func TestNewWithDisabledCommand(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		command       string
+		expectedType  interface{}
+		expectedError string
+	}{
+		{
+			desc:         "it returns the command when it is enabled",
+			command:      "git-upload-pack 'group/repo'",
+			expectedType: &uploadpack.Command{},
+		},
+		{
+			desc:          "it rejects the command when it is disabled",
+			command:       "git-upload-archive 'group/repo'",
+			expectedError: "Archives are disabled",
+		},
+		{
+			desc:          "it rejects disabled commands the Ruby implementation runs",
+			command:       "2fa_recovery_codes",
+			expectedError: "Archives are disabled",
+		},
+	}
+
+	cfg := &config.Config{
+		GitlabUrl: "http+unix://gitlab.socket",
+		Migration: config.MigrationConfig{Enabled: true, Features: []string{"git-upload-pack", "git-upload-archive"}},
+		Commands:  config.CommandsConfig{Enabled: []string{"discover", "git-upload-pack"}, DisabledMessage: "Archives are disabled"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "1", "SSH_ORIGINAL_COMMAND": tc.command})
+			defer restoreEnv()
+
+			command, err := New([]string{}, cfg)
+			assert.NoError(t, err)
+
+			if tc.expectedError == "" {
+				assert.IsType(t, tc.expectedType, command)
+				return
+			}
+
+			err = command.Execute(&readwriter.ReadWriter{})
+			assert.EqualError(t, err, tc.expectedError)
+			assert.IsType(t, &console.Error{}, err)
+		})
+	}
+}
+
+func TestNewInMaintenance(t *testing.T) {
+	restoreEnv := testhelper.TempEnv(map[string]string{
+		"SSH_CONNECTION":       "1",
+		"SSH_ORIGINAL_COMMAND": "git-receive-pack 'group/repo'",
+	})
+	defer restoreEnv()
+
+	cfg := &config.Config{
+		GitlabUrl:   "http+unix://gitlab.socket",
+		Maintenance: config.MaintenanceConfig{Mode: "read_only"},
+	}
+
+	command, err := New([]string{}, cfg)
+	assert.NoError(t, err)
+
+	err = command.Execute(&readwriter.ReadWriter{})
+	assert.EqualError(t, err, "The GitLab server is in read-only mode for maintenance, pushes are disabled.")
+	assert.Equal(t, 69, err.(*maintenance.Error).ExitCode())
+}
+
+func TestNewWithAdmissionControl(t *testing.T) {
+	cfg := &config.Config{
+		GitlabUrl: "http+unix://gitlab.socket",
+		Migration: config.MigrationConfig{Enabled: true, Features: []string{"discover", "git-upload-pack"}},
+		Admission: config.AdmissionConfig{MaxConcurrent: 10},
+	}
+
+	restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "1", "SSH_ORIGINAL_COMMAND": "git-upload-pack 'group/repo'"})
+	defer restoreEnv()
+
+	command, err := New([]string{}, cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &admittedCommand{}, command)
+	assert.IsType(t, &uploadpack.Command{}, command.(*admittedCommand).Command)
+
+	restoreEnv = testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "1", "SSH_ORIGINAL_COMMAND": ""})
+	defer restoreEnv()
+
+	command, err = New([]string{}, cfg)
+	assert.NoError(t, err)
+	assert.IsType(t, &discover.Command{}, command)
+}
+
 func TestFailingNew(t *testing.T) {
 	t.Run("It returns an error when SSH_CONNECTION is not set", func(t *testing.T) {
 		restoreEnv := testhelper.TempEnv(map[string]string{})
@@ -0,0 +1,48 @@
+package commandargs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AuthorizedKeys holds the arguments sshd passes to an AuthorizedKeysCommand
+// configured as `gitlab-shell-authorized-keys-check git %u %k`, or as
+// `gitlab-shell-authorized-keys-check git %u %t %f` to look keys up by their
+// fingerprint instead.
+type AuthorizedKeys struct {
+	ExpectedUser string
+	ActualUser   string
+	Key          string
+	KeyType      string
+	Fingerprint  string
+}
+
+func ParseAuthorizedKeys(arguments []string) (*AuthorizedKeys, error) {
+	var args *AuthorizedKeys
+
+	switch len(arguments) {
+	case 3:
+		args = &AuthorizedKeys{ExpectedUser: arguments[0], ActualUser: arguments[1], Key: arguments[2]}
+	case 4:
+		args = &AuthorizedKeys{ExpectedUser: arguments[0], ActualUser: arguments[1], KeyType: arguments[2], Fingerprint: arguments[3]}
+	default:
+		return nil, fmt.Errorf("# Wrong number of arguments. %d. Usage:\n#     gitlab-shell-authorized-keys-check <expected-username> <actual-username> <key>\n#     gitlab-shell-authorized-keys-check <expected-username> <actual-username> <key-type> <fingerprint>", len(arguments))
+	}
+
+	if args.ExpectedUser == "" || args.ActualUser == "" {
+		return nil, errors.New("# No username provided")
+	}
+
+	return args, nil
+}
+
+// Matches tells whether sshd asks for the user gitlab-shell runs as. Normally
+// these would both be 'git', but it can be configured by the user.
+func (a *AuthorizedKeys) Matches() bool {
+	return a.ExpectedUser == a.ActualUser
+}
+
+// ByFingerprint tells whether the key is given by its type and fingerprint
+func (a *AuthorizedKeys) ByFingerprint() bool {
+	return a.Fingerprint != "" || a.KeyType != ""
+}
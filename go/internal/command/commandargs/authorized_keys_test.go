@@ -0,0 +1,60 @@
+package commandargs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	args, err := ParseAuthorizedKeys([]string{"git", "git", "ssh-rsa AAAA"})
+	require.NoError(t, err)
+
+	require.Equal(t, &AuthorizedKeys{ExpectedUser: "git", ActualUser: "git", Key: "ssh-rsa AAAA"}, args)
+	require.True(t, args.Matches())
+	require.False(t, args.ByFingerprint())
+}
+
+func TestParseAuthorizedKeysByFingerprint(t *testing.T) {
+	args, err := ParseAuthorizedKeys([]string{"git", "git", "ssh-ed25519", "SHA256:noXBB6xNCj6nsadR0HGFdACSRMSdHOl62fCbdoFJoxU"})
+	require.NoError(t, err)
+
+	require.Equal(t, &AuthorizedKeys{ExpectedUser: "git", ActualUser: "git", KeyType: "ssh-ed25519", Fingerprint: "SHA256:noXBB6xNCj6nsadR0HGFdACSRMSdHOl62fCbdoFJoxU"}, args)
+	require.True(t, args.ByFingerprint())
+}
+
+func TestParseAuthorizedKeysFailures(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		arguments     []string
+		expectedError string
+	}{
+		{
+			desc:          "With not enough arguments",
+			arguments:     []string{"git", "git"},
+			expectedError: "# Wrong number of arguments. 2. Usage:\n#     gitlab-shell-authorized-keys-check <expected-username> <actual-username> <key>\n#     gitlab-shell-authorized-keys-check <expected-username> <actual-username> <key-type> <fingerprint>",
+		},
+		{
+			desc:          "With an empty expected user",
+			arguments:     []string{"", "git", "key"},
+			expectedError: "# No username provided",
+		},
+		{
+			desc:          "With an empty actual user",
+			arguments:     []string{"git", "", "key"},
+			expectedError: "# No username provided",
+		},
+		{
+			desc:          "With too many arguments",
+			arguments:     []string{"git", "git", "ssh-rsa", "SHA256:AAAA", "extra"},
+			expectedError: "# Wrong number of arguments. 5. Usage:\n#     gitlab-shell-authorized-keys-check <expected-username> <actual-username> <key>\n#     gitlab-shell-authorized-keys-check <expected-username> <actual-username> <key-type> <fingerprint>",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ParseAuthorizedKeys(tc.arguments)
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
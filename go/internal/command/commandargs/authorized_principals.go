@@ -0,0 +1,34 @@
+package commandargs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// AuthorizedPrincipals holds the arguments sshd passes to an
+// AuthorizedPrincipalsCommand configured as
+// `gitlab-shell-authorized-principals-check %i sshUsers`.
+type AuthorizedPrincipals struct {
+	KeyId      string
+	Principals []string
+}
+
+func ParseAuthorizedPrincipals(arguments []string) (*AuthorizedPrincipals, error) {
+	if len(arguments) < 2 {
+		return nil, fmt.Errorf("# Wrong number of arguments. %d. Usage:\n#     gitlab-shell-authorized-principals-check <key-id> <principal1> [<principal2>...]", len(arguments))
+	}
+
+	args := &AuthorizedPrincipals{KeyId: arguments[0], Principals: arguments[1:]}
+
+	if args.KeyId == "" {
+		return nil, errors.New("# No key_id provided")
+	}
+
+	for _, principal := range args.Principals {
+		if principal == "" {
+			return nil, errors.New("# An invalid principal was provided")
+		}
+	}
+
+	return args, nil
+}
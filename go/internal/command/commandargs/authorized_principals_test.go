@@ -0,0 +1,45 @@
+package commandargs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthorizedPrincipals(t *testing.T) {
+	args, err := ParseAuthorizedPrincipals([]string{"key", "principal-1", "principal-2"})
+	require.NoError(t, err)
+
+	require.Equal(t, &AuthorizedPrincipals{KeyId: "key", Principals: []string{"principal-1", "principal-2"}}, args)
+}
+
+func TestParseAuthorizedPrincipalsFailures(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		arguments     []string
+		expectedError string
+	}{
+		{
+			desc:          "With not enough arguments",
+			arguments:     []string{"key"},
+			expectedError: "# Wrong number of arguments. 1. Usage:\n#     gitlab-shell-authorized-principals-check <key-id> <principal1> [<principal2>...]",
+		},
+		{
+			desc:          "With an empty key id",
+			arguments:     []string{"", "principal"},
+			expectedError: "# No key_id provided",
+		},
+		{
+			desc:          "With an empty principal",
+			arguments:     []string{"key", "principal", ""},
+			expectedError: "# An invalid principal was provided",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := ParseAuthorizedPrincipals(tc.arguments)
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
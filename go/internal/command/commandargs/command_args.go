@@ -2,8 +2,10 @@ package commandargs
 
 import (
 	"errors"
+	"net"
 	"os"
 	"regexp"
+	"strings"
 )
 
 type CommandType string
@@ -11,33 +13,68 @@ type CommandType string
 const (
 	Discover         CommandType = "discover"
 	TwoFactorRecover CommandType = "2fa_recovery_codes"
+	ReceivePack      CommandType = "git-receive-pack"
+	UploadPack       CommandType = "git-upload-pack"
+	UploadArchive    CommandType = "git-upload-archive"
+	LfsAuthenticate  CommandType = "git-lfs-authenticate"
+	LfsTransfer      CommandType = "git-lfs-transfer"
 )
 
 var (
 	whoKeyRegex      = regexp.MustCompile(`\bkey-(?P<keyid>\d+)\b`)
 	whoUsernameRegex = regexp.MustCompile(`\busername-(?P<username>\S+)\b`)
+	whoUserIdRegex   = regexp.MustCompile(`\buser-(?P<userid>\d+)\b`)
 )
 
+// SshConnection is the connection as described by sshd in SSH_CONNECTION
+type SshConnection struct {
+	RemoteIp   string
+	RemotePort string
+	LocalIp    string
+	LocalPort  string
+}
+
 type CommandArgs struct {
 	GitlabUsername string
 	GitlabKeyId    string
+	GitlabUserId   string
+	SshArgs        []string
 	SshCommand     string
 	CommandType    CommandType
+	// Certificate is set when sshd exposes that the user authenticated
+	// with a certificate
+	Certificate   *Certificate
+	SshConnection SshConnection
 }
 
 func Parse(arguments []string) (*CommandArgs, error) {
-	if sshConnection := os.Getenv("SSH_CONNECTION"); sshConnection == "" {
+	sshConnection := os.Getenv("SSH_CONNECTION")
+	if sshConnection == "" {
 		return nil, errors.New("Only ssh allowed")
 	}
 
-	info := &CommandArgs{}
+	info := &CommandArgs{SshConnection: ParseSshConnection(sshConnection)}
 
 	info.parseWho(arguments)
-	info.parseCommand(os.Getenv("SSH_ORIGINAL_COMMAND"))
+	info.Certificate = parseUserAuth(os.Getenv("SSH_USER_AUTH"))
+	if err := info.parseCommand(os.Getenv("SSH_ORIGINAL_COMMAND")); err != nil {
+		return nil, err
+	}
 
 	return info, nil
 }
 
+// ParseSshConnection parses `client_ip client_port server_ip server_port`,
+// leaving everything empty when the value doesn't look like that.
+func ParseSshConnection(value string) SshConnection {
+	fields := strings.Fields(value)
+	if len(fields) != 4 || net.ParseIP(fields[0]) == nil || net.ParseIP(fields[2]) == nil {
+		return SshConnection{}
+	}
+
+	return SshConnection{RemoteIp: fields[0], RemotePort: fields[1], LocalIp: fields[2], LocalPort: fields[3]}
+}
+
 func (c *CommandArgs) parseWho(arguments []string) {
 	for _, argument := range arguments {
 		if keyId := tryParseKeyId(argument); keyId != "" {
@@ -49,6 +86,11 @@ func (c *CommandArgs) parseWho(arguments []string) {
 			c.GitlabUsername = username
 			break
 		}
+
+		if userId := tryParseUserId(argument); userId != "" {
+			c.GitlabUserId = userId
+			break
+		}
 	}
 }
 
@@ -74,14 +116,118 @@ func tryParseUsername(argument string) string {
 	return ""
 }
 
-func (c *CommandArgs) parseCommand(commandString string) {
+func tryParseUserId(argument string) string {
+	matchInfo := whoUserIdRegex.FindStringSubmatch(argument)
+	if len(matchInfo) == 2 {
+		// The first element is the full matched string
+		// The second element is the named `userid`
+		return matchInfo[1]
+	}
+
+	return ""
+}
+
+func (c *CommandArgs) parseCommand(commandString string) error {
 	c.SshCommand = commandString
 
 	if commandString == "" {
 		c.CommandType = Discover
+		return nil
+	}
+
+	args, err := splitShellwords(commandString)
+	if err != nil {
+		return err
 	}
 
-	if CommandType(commandString) == TwoFactorRecover {
-		c.CommandType = TwoFactorRecover
+	// Handle Git for Windows 2.14 using "git upload-pack" instead of git-upload-pack
+	if len(args) == 3 && args[0] == "git" {
+		args = []string{"git-" + args[1], args[2]}
 	}
+
+	c.SshArgs = args
+
+	if len(args) > 0 {
+		c.CommandType = knownCommandType(args[0])
+	}
+
+	return nil
+}
+
+// IsGitOperation tells whether the command transfers Git or LFS objects
+func (c CommandType) IsGitOperation() bool {
+	switch c {
+	case UploadPack, ReceivePack, UploadArchive, LfsTransfer:
+		return true
+	}
+
+	return false
+}
+
+func knownCommandType(command string) CommandType {
+	switch CommandType(command) {
+	case TwoFactorRecover, ReceivePack, UploadPack, UploadArchive, LfsAuthenticate, LfsTransfer:
+		return CommandType(command)
+	}
+
+	return ""
+}
+
+// splitShellwords splits the command string the way Ruby's
+// Shellwords.shellwords does: on unquoted whitespace, honouring single
+// quotes, double quotes and backslash escapes.
+func splitShellwords(commandString string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(commandString); i++ {
+		char := commandString[i]
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case char == '\\':
+			inWord = true
+			i++
+			if i < len(commandString) {
+				word.WriteByte(commandString[i])
+			}
+		case char == '\'':
+			inWord = true
+			end := strings.IndexByte(commandString[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("Unmatched quote")
+			}
+			word.WriteString(commandString[i+1 : i+1+end])
+			i += end + 1
+		case char == '"':
+			inWord = true
+			for i++; ; i++ {
+				if i >= len(commandString) {
+					return nil, errors.New("Unmatched quote")
+				}
+				if commandString[i] == '"' {
+					break
+				}
+				if commandString[i] == '\\' && i+1 < len(commandString) {
+					i++
+				}
+				word.WriteByte(commandString[i])
+			}
+		default:
+			inWord = true
+			word.WriteByte(char)
+		}
+	}
+
+	if inWord {
+		args = append(args, word.String())
+	}
+
+	return args, nil
 }
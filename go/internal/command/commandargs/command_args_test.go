@@ -30,7 +30,7 @@ func TestParseSuccess(t *testing.T) {
 				"SSH_CONNECTION":       "1",
 				"SSH_ORIGINAL_COMMAND": "hello world",
 			},
-			expectedArgs: &CommandArgs{SshCommand: "hello world"},
+			expectedArgs: &CommandArgs{SshArgs: []string{"hello", "world"}, SshCommand: "hello world"},
 		}, {
 			desc: "It finds the key id in any passed arguments",
 			environment: map[string]string{
@@ -47,6 +47,104 @@ func TestParseSuccess(t *testing.T) {
 			},
 			arguments:    []string{"hello", "username-jane-doe"},
 			expectedArgs: &CommandArgs{CommandType: Discover, GitlabUsername: "jane-doe"},
+		}, {
+			desc: "It finds the user id in any passed arguments",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "",
+			},
+			arguments:    []string{"hello", "user-42"},
+			expectedArgs: &CommandArgs{CommandType: Discover, GitlabUserId: "42"},
+		}, {
+			desc: "It parses 2fa_recovery_codes command",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "2fa_recovery_codes",
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"2fa_recovery_codes"}, SshCommand: "2fa_recovery_codes", CommandType: TwoFactorRecover},
+		}, {
+			desc: "It parses git-receive-pack command",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-receive-pack group/repo",
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-receive-pack", "group/repo"}, SshCommand: "git-receive-pack group/repo", CommandType: ReceivePack},
+		}, {
+			desc: "It parses git-receive-pack command and a project with single quotes",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git receive-pack 'group/repo'",
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-receive-pack", "group/repo"}, SshCommand: "git receive-pack 'group/repo'", CommandType: ReceivePack},
+		}, {
+			desc: `It parses "git receive-pack" command`,
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": `git receive-pack "group/repo"`,
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-receive-pack", "group/repo"}, SshCommand: `git receive-pack "group/repo"`, CommandType: ReceivePack},
+		}, {
+			desc: `It parses a command followed by control characters`,
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": `git-receive-pack group/repo; any command`,
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-receive-pack", "group/repo;", "any", "command"}, SshCommand: `git-receive-pack group/repo; any command`, CommandType: ReceivePack},
+		}, {
+			desc: "It parses git-upload-pack command",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": `git upload-pack "group/repo"`,
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-upload-pack", "group/repo"}, SshCommand: `git upload-pack "group/repo"`, CommandType: UploadPack},
+		}, {
+			desc: "It parses git-upload-archive command",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-upload-archive 'group/repo'",
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-upload-archive", "group/repo"}, SshCommand: "git-upload-archive 'group/repo'", CommandType: UploadArchive},
+		}, {
+			desc: "It parses git-lfs-authenticate command",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-lfs-authenticate 'group/repo' download",
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-lfs-authenticate", "group/repo", "download"}, SshCommand: "git-lfs-authenticate 'group/repo' download", CommandType: LfsAuthenticate},
+		}, {
+			desc: "It parses git-lfs-transfer command",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "1",
+				"SSH_ORIGINAL_COMMAND": "git-lfs-transfer 'group/repo' upload",
+			},
+			expectedArgs: &CommandArgs{SshArgs: []string{"git-lfs-transfer", "group/repo", "upload"}, SshCommand: "git-lfs-transfer 'group/repo' upload", CommandType: LfsTransfer},
+		}, {
+			desc: "It parses the connection",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "192.168.1.10 51234 10.0.0.1 22",
+				"SSH_ORIGINAL_COMMAND": "",
+			},
+			expectedArgs: &CommandArgs{
+				CommandType:   Discover,
+				SshConnection: SshConnection{RemoteIp: "192.168.1.10", RemotePort: "51234", LocalIp: "10.0.0.1", LocalPort: "22"},
+			},
+		}, {
+			desc: "It parses an IPv6 connection",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "2001:db8::1 51234 2001:db8::2 22",
+				"SSH_ORIGINAL_COMMAND": "",
+			},
+			expectedArgs: &CommandArgs{
+				CommandType:   Discover,
+				SshConnection: SshConnection{RemoteIp: "2001:db8::1", RemotePort: "51234", LocalIp: "2001:db8::2", LocalPort: "22"},
+			},
+		}, {
+			desc: "It ignores a malformed connection",
+			environment: map[string]string{
+				"SSH_CONNECTION":       "not-an-ip 51234 10.0.0.1 22",
+				"SSH_ORIGINAL_COMMAND": "",
+			},
+			expectedArgs: &CommandArgs{CommandType: Discover},
 		},
 	}
 
@@ -70,4 +168,15 @@ func TestParseFailure(t *testing.T) {
 		assert.Error(t, err, "Only ssh allowed")
 	})
 
+	t.Run("It fails if the command contains an unmatched quote", func(t *testing.T) {
+		restoreEnv := testhelper.TempEnv(map[string]string{
+			"SSH_CONNECTION":       "1",
+			"SSH_ORIGINAL_COMMAND": "git-receive-pack 'group/repo",
+		})
+		defer restoreEnv()
+
+		_, err := Parse([]string{})
+
+		assert.EqualError(t, err, "Unmatched quote")
+	})
 }
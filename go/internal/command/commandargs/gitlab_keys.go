@@ -0,0 +1,31 @@
+package commandargs
+
+// GitlabKeys holds the arguments of gitlab-keys, such as
+// `gitlab-keys add-key key-782 "ssh-rsa AAAAx321..."`.
+type GitlabKeys struct {
+	Subcommand string
+	KeyId      string
+	Key        string
+	// Json is set by --json, for subcommands that report on their findings
+	Json bool
+}
+
+func ParseGitlabKeys(arguments []string) *GitlabKeys {
+	args := &GitlabKeys{}
+	fields := []*string{&args.Subcommand, &args.KeyId, &args.Key}
+
+	i := 0
+	for _, argument := range arguments {
+		if argument == "--json" {
+			args.Json = true
+			continue
+		}
+
+		if i < len(fields) {
+			*fields[i] = argument
+			i++
+		}
+	}
+
+	return args
+}
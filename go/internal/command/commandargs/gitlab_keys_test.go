@@ -0,0 +1,42 @@
+package commandargs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGitlabKeys(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		arguments    []string
+		expectedArgs *GitlabKeys
+	}{
+		{
+			desc:         "With add-key arguments",
+			arguments:    []string{"add-key", "key-782", "ssh-rsa AAAAx321"},
+			expectedArgs: &GitlabKeys{Subcommand: "add-key", KeyId: "key-782", Key: "ssh-rsa AAAAx321"},
+		},
+		{
+			desc:         "With rm-key arguments",
+			arguments:    []string{"rm-key", "key-23"},
+			expectedArgs: &GitlabKeys{Subcommand: "rm-key", KeyId: "key-23"},
+		},
+		{
+			desc:         "With a json flag",
+			arguments:    []string{"verify", "--json"},
+			expectedArgs: &GitlabKeys{Subcommand: "verify", Json: true},
+		},
+		{
+			desc:         "Without arguments",
+			arguments:    []string{},
+			expectedArgs: &GitlabKeys{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.expectedArgs, ParseGitlabKeys(tc.arguments))
+		})
+	}
+}
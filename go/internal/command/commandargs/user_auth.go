@@ -0,0 +1,66 @@
+package commandargs
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/sshkey"
+)
+
+// Certificate describes the SSH certificate a user authenticated with
+type Certificate struct {
+	KeyId         string   `json:"key_id"`
+	Principals    []string `json:"principals"`
+	Serial        uint64   `json:"serial"`
+	CaFingerprint string   `json:"ca_fingerprint"`
+}
+
+// parseUserAuth reads the SSH_USER_AUTH file sshd writes with ExposeAuthInfo,
+// which has a line per authentication method, such as
+//
+//	publickey ssh-ed25519-cert-v01@openssh.com AAAAIHNzaC1lZDI1NTE5LWNlcnQtdjAxQG9w...
+//
+// It returns the first certificate found, if any. The file is only a source
+// of extra details, so that problems reading it are ignored.
+func parseUserAuth(path string) *Certificate {
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Certificates can be longer than the default 64KB limit of a line
+	scanner.Buffer(nil, 1024*1024)
+
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 2)
+		if len(fields) != 2 || fields[0] != "publickey" {
+			continue
+		}
+
+		key, err := sshkey.Parse(fields[1])
+		if err != nil || !key.IsCertificate() {
+			continue
+		}
+
+		cert, err := key.Certificate()
+		if err != nil {
+			continue
+		}
+
+		return &Certificate{
+			KeyId:         cert.KeyId,
+			Principals:    cert.Principals,
+			Serial:        cert.Serial,
+			CaFingerprint: cert.CaFingerprint(),
+		}
+	}
+
+	return nil
+}
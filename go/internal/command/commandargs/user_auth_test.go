@@ -0,0 +1,72 @@
+package commandargs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/testhelper"
+)
+
+const (
+	ed25519Key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAhAg84Lrg+DZY6mkZTxo7xZECLzyfa//7+2Q5/HJ5dz"
+	// ssh-keygen -s ca -I alice@example.com -n alice,deploy -z 42 user.pub
+	certKey = "ssh-ed25519-cert-v01@openssh.com AAAAIHNzaC1lZDI1NTE5LWNlcnQtdjAxQG9wZW5zc2guY29tAAAAIEODRQdvA3QztrEItuzPhQepv7O9e7C4lNQNRMJ93TkVAAAAIJdt6osSXaXpwPqK8b5xpmIQTPISXwpgxOAODbL56F+TAAAAAAAAACoAAAABAAAAEWFsaWNlQGV4YW1wbGUuY29tAAAAEwAAAAVhbGljZQAAAAZkZXBsb3kAAAAAAAAAAP//////////AAAAAAAAAIIAAAAVcGVybWl0LVgxMS1mb3J3YXJkaW5nAAAAAAAAABdwZXJtaXQtYWdlbnQtZm9yd2FyZGluZwAAAAAAAAAWcGVybWl0LXBvcnQtZm9yd2FyZGluZwAAAAAAAAAKcGVybWl0LXB0eQAAAAAAAAAOcGVybWl0LXVzZXItcmMAAAAAAAAAAAAAADMAAAALc3NoLWVkMjU1MTkAAAAgQh4QP+vn+sj2IAtN0G7VByZhF9qzhG36rDfV2FeLJvkAAABTAAAAC3NzaC1lZDI1NTE5AAAAQBOK6wMEbtFJjaXlWBIK7SohxijEbVaAJqsF69c9EXIAVPtum4+PwuHaf+wqLHLiEHQ+qJG09dEumLBvfTspZA8="
+)
+
+func TestParseUserAuth(t *testing.T) {
+	testCases := []struct {
+		desc                string
+		content             string
+		expectedCertificate *Certificate
+	}{
+		{
+			desc:    "With a certificate",
+			content: "password\npublickey " + ed25519Key + "\npublickey " + certKey + "\n",
+			expectedCertificate: &Certificate{
+				KeyId:         "alice@example.com",
+				Principals:    []string{"alice", "deploy"},
+				Serial:        42,
+				CaFingerprint: "SHA256:c7Burg4wPUDe0zRHARpsGe9DWk81qXrdhaUY4UZDJnU",
+			},
+		},
+		{
+			desc:    "With a plain key",
+			content: "publickey " + ed25519Key + "\n",
+		},
+		{
+			desc:    "With garbage",
+			content: "publickey ssh-ed25519-cert-v01@openssh.com AAAA\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "ssh-user-auth")
+			require.NoError(t, err)
+			defer os.Remove(file.Name())
+
+			_, err = file.WriteString(tc.content)
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+
+			restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "1", "SSH_USER_AUTH": file.Name()})
+			defer restoreEnv()
+
+			args, err := Parse([]string{"key-1"})
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedCertificate, args.Certificate)
+		})
+	}
+}
+
+func TestParseUserAuthWithoutFile(t *testing.T) {
+	restoreEnv := testhelper.TempEnv(map[string]string{"SSH_CONNECTION": "1", "SSH_USER_AUTH": "/does/not/exist"})
+	defer restoreEnv()
+
+	args, err := Parse([]string{"key-1"})
+	require.NoError(t, err)
+	require.Nil(t, args.Certificate)
+}
@@ -0,0 +1,236 @@
+package customaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/accessverifier"
+)
+
+const (
+	noMessageText = "No message"
+)
+
+// The messages match the ones of the errors raised by Action::Custom, so
+// users see the same output from both implementations.
+var (
+	ErrMissingPayload      = errors.New("Action::Custom::MissingPayloadError")
+	ErrMissingData         = errors.New("Action::Custom::MissingDataError")
+	ErrMissingApiEndpoints = errors.New("Action::Custom::MissingAPIEndpointsError")
+	ErrInvalidJSON         = errors.New("Response was not valid JSON")
+)
+
+type Request struct {
+	Data   accessverifier.CustomPayloadData `json:"data"`
+	Output []byte                           `json:"output"`
+}
+
+type Response struct {
+	Result  []byte `json:"result"`
+	Message string `json:"message"`
+}
+
+type Command struct {
+	Config     *config.Config
+	Response   *accessverifier.Response
+	ReadWriter *readwriter.ReadWriter
+}
+
+func (c *Command) Execute() error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	data := c.Response.Payload.Data
+	if data.InfoMessage != "" {
+		console.DisplayMessage(data.InfoMessage, c.ReadWriter.ErrOut)
+	}
+
+	return c.processApiEndpoints(data)
+}
+
+func (c *Command) validate() error {
+	payload := c.Response.Payload
+
+	if payload.Action == "" && payload.Data == nil {
+		return ErrMissingPayload
+	}
+
+	if payload.Data == nil {
+		return ErrMissingData
+	}
+
+	if len(payload.Data.ApiEndpoints) == 0 {
+		return ErrMissingApiEndpoints
+	}
+
+	return nil
+}
+
+func (c *Command) processApiEndpoints(data *accessverifier.CustomPayloadData) error {
+	client, err := gitlabnet.GetClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	request := &Request{Data: *data}
+	request.Data.UserId = c.Response.Who
+
+	if data.Streaming {
+		return c.processStreamingApiEndpoints(client, request)
+	}
+
+	for _, endpoint := range data.ApiEndpoints {
+		response, err := c.performRequest(client, endpoint, request)
+		if err != nil {
+			return err
+		}
+
+		if _, err := c.ReadWriter.Out.Write(response.Result); err != nil {
+			return err
+		}
+
+		// In the context of the git push sequence of events, it's necessary to read
+		// stdin in order to capture output to pass onto subsequent commands
+		output, err := ioutil.ReadAll(c.ReadWriter.In)
+		if err != nil {
+			return err
+		}
+		request.Output = output
+	}
+
+	return nil
+}
+
+func (c *Command) performRequest(client *gitlabnet.GitlabClient, endpoint string, request *Request) (*Response, error) {
+	response, err := client.PostApi(endpoint, request)
+	if err != nil {
+		return nil, unsuccessfulError(err)
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+// processStreamingApiEndpoints is used when GitLab advertises that the
+// primary accepts streamed pushes. Instead of buffering stdin and sending it
+// base64 encoded in a JSON document, the data is sent as the "output" part of
+// a multipart body while it is read, and the response body is relayed to the
+// client as it arrives.
+func (c *Command) processStreamingApiEndpoints(client *gitlabnet.GitlabClient, request *Request) error {
+	var input io.Reader = bytes.NewReader(nil)
+
+	for _, endpoint := range request.Data.ApiEndpoints {
+		if err := c.performStreamingRequest(client, endpoint, request, input); err != nil {
+			return err
+		}
+
+		// In the context of the git push sequence of events, the client's
+		// next input has to be passed on to the next endpoint
+		input = c.ReadWriter.In
+	}
+
+	return nil
+}
+
+func (c *Command) performStreamingRequest(client *gitlabnet.GitlabClient, endpoint string, request *Request, input io.Reader) error {
+	bodyReader, bodyWriter := io.Pipe()
+	multipartWriter := multipart.NewWriter(bodyWriter)
+
+	copyDone := make(chan struct{})
+	go func() {
+		defer close(copyDone)
+		bodyWriter.CloseWithError(writeMultipartBody(multipartWriter, request, input))
+	}()
+
+	response, err := client.PostStream(endpoint, multipartWriter.FormDataContentType(), bodyReader)
+	if err != nil {
+		// The request failed before the whole body was sent, so the copy
+		// has to stop even while it waits for more input
+		bodyReader.CloseWithError(err)
+		if interruptRead(input) {
+			<-copyDone
+		}
+
+		return unsuccessfulError(err)
+	}
+	bodyReader.Close()
+	defer response.Body.Close()
+
+	_, err = io.Copy(c.ReadWriter.Out, response.Body)
+
+	return err
+}
+
+func writeMultipartBody(multipartWriter *multipart.Writer, request *Request, input io.Reader) error {
+	data, err := json.Marshal(request.Data)
+	if err != nil {
+		return err
+	}
+
+	if err := multipartWriter.WriteField("data", string(data)); err != nil {
+		return err
+	}
+
+	output, err := multipartWriter.CreateFormFile("output", "output")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(output, input); err != nil {
+		return err
+	}
+
+	return multipartWriter.Close()
+}
+
+// interruptRead makes a pending read of input return, which is only possible
+// when input supports deadlines. Otherwise the copy stops at its next write
+// to the closed pipe.
+func interruptRead(input io.Reader) bool {
+	deadliner, ok := input.(interface{ SetReadDeadline(time.Time) error })
+
+	return ok && deadliner.SetReadDeadline(time.Now()) == nil
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := json.NewDecoder(hr.Body).Decode(response); err != nil {
+		return nil, ErrInvalidJSON
+	}
+
+	return response, nil
+}
+
+// unsuccessfulError is the error of Action::Custom#raise_unsuccessful!: the
+// message of the response, or else its decoded result, shown to the user.
+func unsuccessfulError(err error) error {
+	apiErr, ok := err.(*gitlabnet.ApiError)
+	if !ok {
+		return err
+	}
+
+	// Result stays empty unless the body has a valid one
+	response := &Response{}
+	json.Unmarshal(apiErr.Body, response)
+
+	message := noMessageText
+	if apiErr.HasMessage && apiErr.Message != "" {
+		message = apiErr.Message
+	} else if len(response.Result) > 0 {
+		message = string(response.Result)
+	}
+
+	return console.NewError(fmt.Sprintf("%s (%d)", message, apiErr.StatusCode))
+}
@@ -0,0 +1,324 @@
+package customaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+func TestExecute(t *testing.T) {
+	who := "key-1"
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/info_refs",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *Request
+				require.NoError(t, json.Unmarshal(b, &request))
+
+				require.Equal(t, request.Data.UserId, who)
+				require.Empty(t, request.Output)
+
+				err = json.NewEncoder(w).Encode(Response{Result: []byte("custom")})
+				require.NoError(t, err)
+			},
+		},
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/push",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var request *Request
+				require.NoError(t, json.Unmarshal(b, &request))
+
+				require.Equal(t, request.Data.UserId, who)
+				require.Equal(t, "input", string(request.Output))
+
+				err = json.NewEncoder(w).Encode(Response{Result: []byte("output")})
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	outBuf := &bytes.Buffer{}
+	errBuf := &bytes.Buffer{}
+	readWriter := &readwriter.ReadWriter{
+		ErrOut: errBuf,
+		Out:    outBuf,
+		In:     bytes.NewBufferString("input"),
+	}
+
+	response := &accessverifier.Response{
+		Who: who,
+		Payload: accessverifier.CustomPayload{
+			Action: "geo_proxy_to_primary",
+			Data: &accessverifier.CustomPayloadData{
+				ApiEndpoints: []string{"/api/v4/geo/proxy_git_push_ssh/info_refs", "/api/v4/geo/proxy_git_push_ssh/push"},
+				Username:     "custom",
+				PrimaryRepo:  "https://repo/path",
+				InfoMessage:  "info_message\nanother_message",
+			},
+		},
+	}
+
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url},
+		Response:   response,
+		ReadWriter: readWriter,
+	}
+
+	require.NoError(t, cmd.Execute())
+
+	require.Equal(t, "customoutput", outBuf.String())
+	require.Equal(t, "> GitLab: info_message\n> GitLab: another_message\n", errBuf.String())
+}
+
+func TestFailingExecute(t *testing.T) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/message",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"message": "Push denied"})
+			},
+		},
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/result",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(&Response{Result: []byte("Push denied\nby the primary")})
+			},
+		},
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/no_message",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/invalid_json",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("{ \"result\": "))
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		payload       accessverifier.CustomPayload
+		expectedError string
+	}{
+		{
+			desc:          "With a missing payload",
+			payload:       accessverifier.CustomPayload{},
+			expectedError: "Action::Custom::MissingPayloadError",
+		},
+		{
+			desc:          "With missing data",
+			payload:       accessverifier.CustomPayload{Action: "geo_proxy_to_primary"},
+			expectedError: "Action::Custom::MissingDataError",
+		},
+		{
+			desc: "With missing API endpoints",
+			payload: accessverifier.CustomPayload{
+				Action: "geo_proxy_to_primary",
+				Data:   &accessverifier.CustomPayloadData{},
+			},
+			expectedError: "Action::Custom::MissingAPIEndpointsError",
+		},
+		{
+			desc: "When the API responds with a message",
+			payload: accessverifier.CustomPayload{
+				Data: &accessverifier.CustomPayloadData{ApiEndpoints: []string{"/api/v4/geo/proxy_git_push_ssh/message"}},
+			},
+			expectedError: "> GitLab: Push denied (403)",
+		},
+		{
+			desc: "When the API responds with a result but no message",
+			payload: accessverifier.CustomPayload{
+				Data: &accessverifier.CustomPayloadData{ApiEndpoints: []string{"/api/v4/geo/proxy_git_push_ssh/result"}},
+			},
+			expectedError: "> GitLab: Push denied\n> GitLab: by the primary (403)",
+		},
+		{
+			desc: "When the API responds without a message",
+			payload: accessverifier.CustomPayload{
+				Data: &accessverifier.CustomPayloadData{ApiEndpoints: []string{"/api/v4/geo/proxy_git_push_ssh/no_message"}},
+			},
+			expectedError: "> GitLab: No message (500)",
+		},
+		{
+			desc: "When the API responds with invalid JSON",
+			payload: accessverifier.CustomPayload{
+				Data: &accessverifier.CustomPayloadData{ApiEndpoints: []string{"/api/v4/geo/proxy_git_push_ssh/invalid_json"}},
+			},
+			expectedError: "Response was not valid JSON",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{
+				Config:     &config.Config{GitlabUrl: url},
+				Response:   &accessverifier.Response{Who: "key-1", Payload: tc.payload},
+				ReadWriter: &readwriter.ReadWriter{Out: &bytes.Buffer{}, ErrOut: &bytes.Buffer{}, In: &bytes.Buffer{}},
+			}
+
+			// As the user sees it
+			output := &bytes.Buffer{}
+			console.DisplayError(cmd.Execute(), output)
+
+			require.Equal(t, tc.expectedError+"\n", output.String())
+		})
+	}
+}
+
+func TestExecuteStreaming(t *testing.T) {
+	who := "key-1"
+
+	readPart := func(t *testing.T, r *http.Request) (*accessverifier.CustomPayloadData, string) {
+		reader, err := r.MultipartReader()
+		require.NoError(t, err)
+
+		form, err := reader.ReadForm(1024)
+		require.NoError(t, err)
+
+		var data *accessverifier.CustomPayloadData
+		require.NoError(t, json.Unmarshal([]byte(form.Value["data"][0]), &data))
+
+		file, err := form.File["output"][0].Open()
+		require.NoError(t, err)
+		output, err := ioutil.ReadAll(file)
+		require.NoError(t, err)
+
+		return data, string(output)
+	}
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/info_refs",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				data, output := readPart(t, r)
+
+				require.Equal(t, who, data.UserId)
+				require.True(t, data.Streaming)
+				require.Empty(t, output)
+
+				w.Write([]byte("custom"))
+			},
+		},
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/push",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				data, output := readPart(t, r)
+
+				require.Equal(t, who, data.UserId)
+				require.Equal(t, "input", output)
+
+				w.Write([]byte("output"))
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	outBuf := &bytes.Buffer{}
+	readWriter := &readwriter.ReadWriter{
+		ErrOut: &bytes.Buffer{},
+		Out:    outBuf,
+		In:     bytes.NewBufferString("input"),
+	}
+
+	response := &accessverifier.Response{
+		Who: who,
+		Payload: accessverifier.CustomPayload{
+			Action: "geo_proxy_to_primary",
+			Data: &accessverifier.CustomPayloadData{
+				ApiEndpoints: []string{"/api/v4/geo/proxy_git_push_ssh/info_refs", "/api/v4/geo/proxy_git_push_ssh/push"},
+				Streaming:    true,
+			},
+		},
+	}
+
+	cmd := &Command{
+		Config:     &config.Config{GitlabUrl: url},
+		Response:   response,
+		ReadWriter: readWriter,
+	}
+
+	require.NoError(t, cmd.Execute())
+	require.Equal(t, "customoutput", outBuf.String())
+}
+
+func TestExecuteStreamingFailure(t *testing.T) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/info_refs",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("custom"))
+			},
+		},
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/push",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"message": "Push denied"})
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	// The client never sends its input nor closes it
+	input, inputWriter, err := os.Pipe()
+	require.NoError(t, err)
+	defer input.Close()
+	defer inputWriter.Close()
+
+	cmd := &Command{
+		Config: &config.Config{GitlabUrl: url},
+		Response: &accessverifier.Response{
+			Who: "key-1",
+			Payload: accessverifier.CustomPayload{
+				Action: "geo_proxy_to_primary",
+				Data: &accessverifier.CustomPayloadData{
+					ApiEndpoints: []string{"/api/v4/geo/proxy_git_push_ssh/info_refs", "/api/v4/geo/proxy_git_push_ssh/push"},
+					Streaming:    true,
+				},
+			},
+		},
+		ReadWriter: &readwriter.ReadWriter{ErrOut: &bytes.Buffer{}, Out: &bytes.Buffer{}, In: input},
+	}
+
+	output := &bytes.Buffer{}
+	console.DisplayError(cmd.Execute(), output)
+
+	require.Equal(t, "> GitLab: Push denied (403)\n", output.String())
+}
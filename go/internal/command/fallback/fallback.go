@@ -11,6 +11,9 @@ import (
 type Command struct {
 	RootDir string
 	Args    []string
+	// Program is the Ruby executable in bin/ to replace the process with.
+	// It defaults to RubyProgram.
+	Program string
 }
 
 var (
@@ -23,9 +26,14 @@ const (
 )
 
 func (c *Command) Execute(*readwriter.ReadWriter) error {
-	rubyCmd := filepath.Join(c.RootDir, "bin", RubyProgram)
+	program := c.Program
+	if program == "" {
+		program = RubyProgram
+	}
 
-	// Ensure rubyArgs[0] is the full path to gitlab-shell-ruby
+	rubyCmd := filepath.Join(c.RootDir, "bin", program)
+
+	// Ensure rubyArgs[0] is the full path to the Ruby program
 	rubyArgs := append([]string{rubyCmd}, c.Args[1:]...)
 
 	return execFunc(rubyCmd, rubyArgs, os.Environ())
@@ -56,6 +56,19 @@ func TestExecuteExecsCommandSuccesfully(t *testing.T) {
 	require.Equal(t, fake.Env, os.Environ())
 }
 
+func TestExecuteExecsGivenProgram(t *testing.T) {
+	cmd := &Command{RootDir: "/tmp", Args: fakeArgs, Program: "gitlab-shell-authorized-keys-check-ruby"}
+
+	// Override the exec func
+	fake := &fakeExec{}
+	fake.Setup()
+	defer fake.Cleanup()
+
+	require.NoError(t, cmd.Execute(nil))
+	require.Equal(t, "/tmp/bin/gitlab-shell-authorized-keys-check-ruby", fake.Filename)
+	require.Equal(t, []string{"/tmp/bin/gitlab-shell-authorized-keys-check-ruby", "foo", "bar"}, fake.Args)
+}
+
 func TestExecuteExecsCommandOnError(t *testing.T) {
 	cmd := &Command{RootDir: "/test", Args: fakeArgs}
 
@@ -0,0 +1,117 @@
+package gitlabkeys
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+func (c *Command) compact() error {
+	return c.withLock(lockTimeout, c.compactAuthFile)
+}
+
+// compactAuthFile drops the lines left by rm-key. The lock must be held.
+func (c *Command) compactAuthFile() error {
+	file, err := os.Open(c.Config.AuthFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	removed := 0
+	err = c.replaceAuthFile(func(w io.Writer) error {
+		return eachLine(file, func(line string) {
+			if isTombstone(line) {
+				removed++
+				return
+			}
+
+			io.WriteString(w, line+"\n")
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Compacted authorized_keys", map[string]interface{}{"removed_lines": removed})
+
+	return nil
+}
+
+// replaceAuthFile atomically replaces the authorized_keys file with what
+// write produces. The lock must be held.
+func (c *Command) replaceAuthFile(write func(w io.Writer) error) error {
+	return replaceFile(c.Config.AuthFile, write)
+}
+
+// replaceFile writes a temporary file next to path, syncs it and renames it
+// into place, so that readers see either the old or the new content.
+func replaceFile(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+
+	tmpFile, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// Cleans up on failure, rename succeeded otherwise
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	if err := tmpFile.Chmod(0600); err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmpFile)
+	if err := write(writer); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// maybeCompact compacts when the share of removed lines crosses the
+// configured threshold. The lock must be held.
+func (c *Command) maybeCompact(tombstones, lines int) error {
+	threshold := c.Config.GitlabKeys.CompactThreshold
+	if threshold <= 0 || lines == 0 || float64(tombstones)/float64(lines) < threshold {
+		return nil
+	}
+
+	return c.compactAuthFile()
+}
+
+// isTombstone tells whether line is one that rm-key overwrote with '#'
+func isTombstone(line string) bool {
+	return line != "" && strings.Trim(line, "#") == ""
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,430 @@
+package gitlabkeys
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/keyline"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/lockfile"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/sshkey"
+)
+
+const (
+	ManagedHeader = "# Managed by gitlab-shell"
+
+	lockTimeout = 10 * time.Second
+	// Allow 5 minutes for batch-add-keys
+	batchLockTimeout = 300 * time.Second
+)
+
+var (
+	// ErrFailed means the failure was already reported on the output
+	ErrFailed = errors.New("gitlab-keys failed")
+
+	// command=".../bin/gitlab-shell key-741" ... ssh-rsa AAAAB3NzaDAxx2E
+	//                              ^^^^^^^
+	whoRegex   = regexp.MustCompile(`^command="[^"]*?\s+([^"\s]+)"`)
+	keyIdRegex = regexp.MustCompile(`key-(\d+)`)
+)
+
+type Command struct {
+	Config *config.Config
+	Args   *commandargs.GitlabKeys
+}
+
+func (c *Command) Execute(readWriter *readwriter.ReadWriter) error {
+	switch c.Args.Subcommand {
+	case "add-key":
+		return c.addKey()
+	case "batch-add-keys":
+		return c.batchAddKeys(readWriter.In, readWriter.ErrOut)
+	case "rm-key":
+		return c.rmKey()
+	case "list-keys":
+		return c.listKeys(readWriter.Out)
+	case "list-key-ids":
+		return c.listKeyIds(readWriter.Out)
+	case "clear":
+		return c.clear()
+	case "compact":
+		return c.compact()
+	case "rebuild":
+		return c.rebuild()
+	case "sync":
+		return c.sync()
+	case "verify":
+		return c.verify(readWriter.Out)
+	case "check-permissions":
+		return c.checkPermissions(readWriter.Out)
+	default:
+		logger.Warn("Attempt to execute invalid gitlab-keys command", map[string]interface{}{"command": fmt.Sprintf("%q", c.Args.Subcommand)})
+		fmt.Fprintln(readWriter.Out, "not allowed")
+
+		return ErrFailed
+	}
+}
+
+func (c *Command) addKey() error {
+	return c.withKeyLock(func(change *keyChange) error {
+		logger.Info("Adding key", map[string]interface{}{"key_id": c.Args.KeyId, "public_key": c.Args.Key})
+
+		keyLine, err := keyline.NewKeyLine(c.Args.KeyId, c.Args.Key, c.Config.RootDir)
+		if err != nil {
+			return err
+		}
+
+		if err := c.checkKey(c.Args.Key); err != nil {
+			return err
+		}
+
+		file, err := c.openAuthFile(os.O_WRONLY | os.O_APPEND | os.O_CREATE)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if _, err := fmt.Fprintln(file, keyLine.ToString()); err != nil {
+			return err
+		}
+		change.add(keyLine.ToString())
+
+		return nil
+	})
+}
+
+// batchAddKeys adds the keys it reads from in, one per line. Invalid keys
+// are reported on errOut and skipped, without blocking the others, and make
+// the command fail once every other key was added.
+func (c *Command) batchAddKeys(in io.Reader, errOut io.Writer) error {
+	return c.withLock(batchLockTimeout, func() error {
+		file, err := c.openAuthFile(os.O_WRONLY | os.O_APPEND | os.O_CREATE)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		writer := bufio.NewWriter(file)
+		reader := bufio.NewReader(in)
+		skipped := 0
+
+		for {
+			input, readErr := reader.ReadString('\n')
+			if input == "" && readErr == io.EOF {
+				break
+			} else if readErr != nil && readErr != io.EOF {
+				writer.Flush()
+				return readErr
+			}
+
+			tokens := splitTabs(strings.TrimSpace(input))
+			if len(tokens) != 2 {
+				writer.Flush()
+				return fmt.Errorf("gitlab-keys: invalid input %q", input)
+			}
+
+			keyId, publicKey := tokens[0], tokens[1]
+			logger.Info("Adding key", map[string]interface{}{"key_id": keyId, "public_key": publicKey})
+
+			keyLine, err := keyline.NewKeyLine(keyId, publicKey, c.Config.RootDir)
+			if err != nil {
+				writer.Flush()
+				return fmt.Errorf("%s: %v", keyId, err)
+			}
+
+			// Like rebuild and sync, a single bad key doesn't block everyone else
+			if err := c.checkKey(publicKey); err != nil {
+				logger.Warn("Skipping invalid key", map[string]interface{}{"key_id": keyId, "error": err.Error()})
+				fmt.Fprintf(errOut, "%s: skipped, %v\n", keyId, err)
+				skipped++
+				continue
+			}
+
+			fmt.Fprintln(writer, keyLine.ToString())
+		}
+
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+
+		if skipped > 0 {
+			return ErrFailed
+		}
+
+		return nil
+	})
+}
+
+// rmKey overwrites the lines of a key with '#' in place, and compacts the
+// file once there are too many of those.
+func (c *Command) rmKey() error {
+	return c.withKeyLock(func(change *keyChange) error {
+		logger.Info("Removing key", map[string]interface{}{"key_id": c.Args.KeyId})
+
+		keyLine, err := keyline.NewKeyLine(c.Args.KeyId, "", c.Config.RootDir)
+		if err != nil {
+			return err
+		}
+		prefix := []byte(fmt.Sprintf(`command="%s"`, keyLine.Command()))
+
+		file, err := c.openAuthFile(os.O_RDWR)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		reader := bufio.NewReader(file)
+		var offset int64
+		var lines, tombstones int
+
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			content := bytes.TrimSuffix(line, []byte("\n"))
+
+			if bytes.HasPrefix(line, prefix) {
+				change.remove(string(content))
+				content = bytes.Repeat([]byte("#"), len(content))
+				if _, err := file.WriteAt(content, offset); err != nil {
+					return err
+				}
+			}
+
+			if len(line) > 0 {
+				lines++
+			}
+			if isTombstone(string(content)) {
+				tombstones++
+			}
+			offset += int64(len(line))
+
+			if readErr == io.EOF {
+				break
+			} else if readErr != nil {
+				return readErr
+			}
+		}
+
+		return c.maybeCompact(tombstones, lines)
+	})
+}
+
+func (c *Command) listKeys(out io.Writer) error {
+	logger.Info("Listing all keys", nil)
+
+	file, err := os.Open(c.Config.AuthFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(out)
+	found := false
+
+	err = eachLine(file, func(line string) {
+		if who, key, ok := parseManagedLine(line); ok {
+			// The key without its type
+			fmt.Fprintf(writer, "%s %s\n", who, strings.TrimSpace(strings.SplitN(key, " ", 2)[1]))
+			found = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// An empty listing still is a line of its own
+	if !found {
+		fmt.Fprintln(writer)
+	}
+
+	return writer.Flush()
+}
+
+func (c *Command) listKeyIds(out io.Writer) error {
+	logger.Info("Listing all key IDs", nil)
+
+	file, err := c.openAuthFile(os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(out)
+
+	err = eachLine(file, func(line string) {
+		if matches := keyIdRegex.FindStringSubmatch(line); matches != nil {
+			fmt.Fprintln(writer, matches[1])
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+func (c *Command) clear() error {
+	return c.withLock(lockTimeout, func() error {
+		file, err := c.openAuthFile(os.O_WRONLY | os.O_CREATE | os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = fmt.Fprintln(file, ManagedHeader)
+
+		return err
+	})
+}
+
+func (c *Command) checkPermissions(out io.Writer) error {
+	file, err := c.openAuthFile(os.O_RDWR | os.O_CREATE)
+	if err == nil {
+		return file.Close()
+	}
+
+	fmt.Fprintf(out, "error: could not open %s: %v\n", c.Config.AuthFile, err)
+
+	ls := exec.Command("ls", "-l", c.Config.AuthFile)
+	if _, statErr := os.Stat(c.Config.AuthFile); os.IsNotExist(statErr) {
+		// Maybe the parent directory is not writable?
+		ls = exec.Command("ls", "-ld", filepath.Dir(c.Config.AuthFile))
+	}
+	ls.Stdout = out
+	ls.Stderr = out
+	ls.Run()
+
+	return ErrFailed
+}
+
+// checkKey makes sure publicKey is a valid key allowed by the configuration
+func (c *Command) checkKey(publicKey string) error {
+	key, err := sshkey.Parse(publicKey)
+	if err != nil {
+		return err
+	}
+
+	policy := &sshkey.Policy{
+		AllowedTypes: c.Config.GitlabKeys.AllowedKeyTypes,
+		MinRsaBits:   c.Config.GitlabKeys.MinRsaBits,
+	}
+
+	return policy.Check(key)
+}
+
+// withLock runs fn, which changes authorized_keys, under the lock and
+// rebuilds the index afterwards, even if fn failed half way.
+func (c *Command) withLock(timeout time.Duration, fn func() error) error {
+	return c.lock(timeout, func() error {
+		err := fn()
+		if indexErr := c.updateIndex(); err == nil {
+			err = indexErr
+		}
+
+		return err
+	})
+}
+
+// withKeyLock is withLock for changes of a single key, which fn records in
+// change so that they are added to the journal of the index.
+func (c *Command) withKeyLock(fn func(change *keyChange) error) error {
+	return c.lock(lockTimeout, func() error {
+		index := c.openFreshIndex()
+		if index != nil {
+			defer index.Close()
+		}
+
+		change := &keyChange{}
+		err := fn(change)
+		if indexErr := c.recordIndex(index, change, err); err == nil {
+			err = indexErr
+		}
+
+		return err
+	})
+}
+
+func (c *Command) lock(timeout time.Duration, fn func() error) error {
+	lock, err := lockfile.Lock(c.Config.AuthFile+".lock", timeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return fn()
+}
+
+func (c *Command) openAuthFile(flag int) (*os.File, error) {
+	file, err := os.OpenFile(c.Config.AuthFile, flag, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := file.Chmod(0600); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// parseManagedLine splits a line written by gitlab-keys into the identifier
+// of its key, such as key-741, and the key itself.
+func parseManagedLine(line string) (string, string, bool) {
+	matches := whoRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return "", "", false
+	}
+
+	_, key, err := sshkey.SplitOptions(line)
+	if err != nil {
+		return "", "", false
+	}
+
+	fields := strings.Fields(key)
+	if len(fields) < 2 || !sshkey.IsKnownType(fields[0]) {
+		return "", "", false
+	}
+
+	return matches[1], strings.Join(fields, " "), true
+}
+
+func eachLine(r io.Reader, fn func(line string)) error {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			fn(strings.TrimSuffix(line, "\n"))
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// splitTabs splits like Ruby's String#split("\t"), which drops trailing empty
+// fields.
+func splitTabs(input string) []string {
+	tokens := strings.Split(input, "\t")
+
+	for len(tokens) > 0 && tokens[len(tokens)-1] == "" {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	return tokens
+}
@@ -0,0 +1,291 @@
+package gitlabkeys
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+)
+
+const (
+	blobA = "AAAAC3NzaC1lZDI1NTE5AAAAIBAVBEWx4mv4LFK9l0ujWsVUFO1zbuILTdiBtvRooK5Q"
+	blobB = "AAAAC3NzaC1lZDI1NTE5AAAAIGUTvNrCr2NV/+KVnmNFlieiQM6iuc7NzfaC2kVNgrEl"
+	blobC = "AAAAC3NzaC1lZDI1NTE5AAAAIB122Q/mYCCRccLA/LX3ZAJ9PVyIQ214Kpjt+nbQr68J"
+	blobD = "AAAAC3NzaC1lZDI1NTE5AAAAIIg14lnbeTs7MZ6FoDY6gpPQKPXEXvGygam8GyiDLSsM"
+	blobE = "AAAAC3NzaC1lZDI1NTE5AAAAIGBc92xQAkSkkgDMW7IRIq8PG9gSfjuKovyvYuPsUzBx"
+
+	keyA = "ssh-ed25519 " + blobA
+	keyB = "ssh-ed25519 " + blobB
+	keyC = "ssh-ed25519 " + blobC
+	keyD = "ssh-ed25519 " + blobD
+	keyE = "ssh-ed25519 " + blobE
+
+	rsa1024Key = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQCrO2P2yhJE8y7ZpZGRwjmdSWy1oLNL4AfafELabx68b6g5SrGv2Xf+Gct4RrUlGG8zILV8ZO4/yyxWcCd0Vj6miQg8iiVnsf2xJV3zWM+dZ7Ofw3caXSe+G9sn87KjMxMT3efwkDWDsaGyF7mmbqg58vNX+2pjni0ZsDsKcOv5AQ=="
+
+	line741 = `command="/tmp/bin/gitlab-shell key-741",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ` + keyA
+	line742 = `command="/tmp/bin/gitlab-shell key-742",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ` + keyB
+)
+
+func setup(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "gitlab-keys")
+	require.NoError(t, err)
+
+	authFile := filepath.Join(dir, "authorized_keys")
+	if content != "" {
+		require.NoError(t, ioutil.WriteFile(authFile, []byte(content), 0644))
+	}
+
+	return authFile, func() { os.RemoveAll(dir) }
+}
+
+func execute(authFile string, input string, arguments ...string) (string, error) {
+	cmd := &Command{
+		Config: &config.Config{RootDir: "/tmp", AuthFile: authFile},
+		Args:   commandargs.ParseGitlabKeys(arguments),
+	}
+
+	output := &bytes.Buffer{}
+	err := cmd.Execute(&readwriter.ReadWriter{In: strings.NewReader(input), Out: output, ErrOut: output})
+
+	return output.String(), err
+}
+
+func requireContent(t *testing.T, authFile string, expected string) {
+	content, err := ioutil.ReadFile(authFile)
+	require.NoError(t, err)
+	require.Equal(t, expected, string(content))
+
+	info, err := os.Stat(authFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestAddKey(t *testing.T) {
+	authFile, cleanup := setup(t, "existing content\n")
+	defer cleanup()
+
+	_, err := execute(authFile, "", "add-key", "key-741", keyA+"\n")
+	require.NoError(t, err)
+
+	requireContent(t, authFile, "existing content\n"+line741+"\n")
+
+	_, err = execute(authFile, "", "add-key", "key-741", keyA+"\n"+keyB)
+	require.EqualError(t, err, "Invalid value: contains a newline")
+}
+
+func TestAddKeyChecksKeys(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		key           string
+		gitlabKeys    config.GitlabKeysConfig
+		expectedError string
+	}{
+		{
+			desc:          "With an invalid key",
+			key:           "ssh-rsa AAAAB3NzaDAxx2E",
+			expectedError: "Invalid key: key blob is not valid base64",
+		},
+		{
+			desc:          "With a key type that is not allowed",
+			key:           keyA,
+			gitlabKeys:    config.GitlabKeysConfig{AllowedKeyTypes: []string{"ssh-rsa"}},
+			expectedError: "Key type ssh-ed25519 is not allowed",
+		},
+		{
+			desc:          "With a short RSA key",
+			key:           rsa1024Key,
+			gitlabKeys:    config.GitlabKeysConfig{MinRsaBits: 2048},
+			expectedError: "RSA keys must have at least 2048 bits, this one has 1024",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cmd := &Command{
+				Config: &config.Config{RootDir: "/tmp", AuthFile: authFile, GitlabKeys: tc.gitlabKeys},
+				Args:   &commandargs.GitlabKeys{Subcommand: "add-key", KeyId: "key-1", Key: tc.key},
+			}
+
+			err := cmd.Execute(&readwriter.ReadWriter{Out: &bytes.Buffer{}})
+			require.EqualError(t, err, tc.expectedError)
+
+			content, _ := ioutil.ReadFile(authFile)
+			require.Empty(t, content)
+		})
+	}
+
+}
+
+func TestBatchAddKeysWithInvalidKeys(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	cmd := &Command{
+		Config: &config.Config{RootDir: "/tmp", AuthFile: authFile, GitlabKeys: config.GitlabKeysConfig{MinRsaBits: 2048}},
+		Args:   &commandargs.GitlabKeys{Subcommand: "batch-add-keys"},
+	}
+
+	input := "key-1\tssh-rsa AAAAB3NzaDAxx2E\n" +
+		"key-2\tssh-ed25519 AAAAB3NzaC1yc2EAAAADAQABAAAAgQCrO2P2\n" +
+		"key-741\t" + keyA + "\n" +
+		"key-3\t" + rsa1024Key + "\n" +
+		"key-742\t" + keyB + "\n"
+	errOut := &bytes.Buffer{}
+
+	// The other keys are still added
+	err := cmd.Execute(&readwriter.ReadWriter{In: strings.NewReader(input), Out: &bytes.Buffer{}, ErrOut: errOut})
+	require.Equal(t, ErrFailed, err)
+	require.Equal(t, "key-1: skipped, Invalid key: key blob is not valid base64\n"+
+		"key-2: skipped, Invalid key: key blob holds a ssh-rsa key, not ssh-ed25519\n"+
+		"key-3: skipped, RSA keys must have at least 2048 bits, this one has 1024\n", errOut.String())
+
+	requireContent(t, authFile, line741+"\n"+line742+"\n")
+}
+
+func TestBatchAddKeys(t *testing.T) {
+	authFile, cleanup := setup(t, "existing content\n")
+	defer cleanup()
+
+	_, err := execute(authFile, "key-741\t"+keyA+"\nkey-742\t"+keyB+"\n", "batch-add-keys")
+	require.NoError(t, err)
+
+	requireContent(t, authFile, "existing content\n"+line741+"\n"+line742+"\n")
+}
+
+func TestBatchAddKeysWithInvalidInput(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	_, err := execute(authFile, "key-741\t"+keyA+"\nkey-742\t\nkey-743\t"+keyC+"\n", "batch-add-keys")
+	require.EqualError(t, err, `gitlab-keys: invalid input "key-742\t\n"`)
+
+	requireContent(t, authFile, line741+"\n")
+}
+
+func TestRmKey(t *testing.T) {
+	authFile, cleanup := setup(t, "existing content\n"+line741+"\n"+line742+"\n")
+	defer cleanup()
+
+	_, err := execute(authFile, "", "rm-key", "key-741")
+	require.NoError(t, err)
+
+	requireContent(t, authFile, "existing content\n"+strings.Repeat("#", len(line741))+"\n"+line742+"\n")
+}
+
+func TestListKeys(t *testing.T) {
+	authFile, cleanup := setup(t, "# Managed by gitlab-shell\n"+line741+"\n"+line742+"\n")
+	defer cleanup()
+
+	output, err := execute(authFile, "", "list-keys")
+	require.NoError(t, err)
+	require.Equal(t, "key-741 "+blobA+"\nkey-742 "+blobB+"\n", output)
+
+	emptyFile, cleanupEmpty := setup(t, "# Managed by gitlab-shell\n")
+	defer cleanupEmpty()
+
+	output, err = execute(emptyFile, "", "list-keys")
+	require.NoError(t, err)
+	require.Equal(t, "\n", output)
+}
+
+func TestListKeyIds(t *testing.T) {
+	authFile, cleanup := setup(t, "key-1\tssh-dsa AAA\nkey-2\tssh-rsa BBB\nkey-3\tssh-rsa CCC\nkey-9000\tssh-rsa DDD\n")
+	defer cleanup()
+
+	output, err := execute(authFile, "", "list-key-ids")
+	require.NoError(t, err)
+	require.Equal(t, "1\n2\n3\n9000\n", output)
+}
+
+func TestClear(t *testing.T) {
+	authFile, cleanup := setup(t, line741+"\n")
+	defer cleanup()
+
+	_, err := execute(authFile, "", "clear")
+	require.NoError(t, err)
+
+	requireContent(t, authFile, "# Managed by gitlab-shell\n")
+}
+
+func TestCheckPermissions(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	_, err := execute(authFile, "", "check-permissions")
+	require.NoError(t, err)
+	requireContent(t, authFile, "")
+
+	output, err := execute(filepath.Join(authFile, "missing", "authorized_keys"), "", "check-permissions")
+	require.Equal(t, ErrFailed, err)
+	require.Contains(t, output, "error: could not open "+authFile+"/missing/authorized_keys")
+}
+
+func TestUnknownSubcommand(t *testing.T) {
+	output, err := execute("/tmp/authorized_keys", "", "nooope")
+
+	require.Equal(t, ErrFailed, err)
+	require.Equal(t, "not allowed\n", output)
+}
+
+func TestCompact(t *testing.T) {
+	authFile, cleanup := setup(t, "# Managed by gitlab-shell\n"+strings.Repeat("#", len(line741))+"\n"+line742+"\n")
+	defer cleanup()
+
+	_, err := execute(authFile, "", "compact")
+	require.NoError(t, err)
+
+	requireContent(t, authFile, "# Managed by gitlab-shell\n"+line742+"\n")
+
+	files, err := ioutil.ReadDir(filepath.Dir(authFile))
+	require.NoError(t, err)
+	require.Len(t, files, 2, "only authorized_keys and its lock remain")
+}
+
+func TestRmKeyCompactsAboveThreshold(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		threshold       float64
+		expectedContent string
+	}{
+		{
+			desc:            "Without a threshold",
+			expectedContent: "# Managed by gitlab-shell\n" + strings.Repeat("#", len(line741)) + "\n" + line742 + "\n",
+		},
+		{
+			desc:            "Below the threshold",
+			threshold:       0.5,
+			expectedContent: "# Managed by gitlab-shell\n" + strings.Repeat("#", len(line741)) + "\n" + line742 + "\n",
+		},
+		{
+			desc:            "Above the threshold",
+			threshold:       0.3,
+			expectedContent: "# Managed by gitlab-shell\n" + line742 + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			authFile, cleanup := setup(t, "# Managed by gitlab-shell\n"+line741+"\n"+line742+"\n")
+			defer cleanup()
+
+			cmd := &Command{
+				Config: &config.Config{RootDir: "/tmp", AuthFile: authFile, GitlabKeys: config.GitlabKeysConfig{CompactThreshold: tc.threshold}},
+				Args:   &commandargs.GitlabKeys{Subcommand: "rm-key", KeyId: "key-741"},
+			}
+
+			require.NoError(t, cmd.Execute(&readwriter.ReadWriter{Out: &bytes.Buffer{}}))
+			requireContent(t, authFile, tc.expectedContent)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package gitlabkeys
+
+import (
+	"os"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/keyindex"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/sshkey"
+)
+
+// keyChange collects the lines that the change of a single key adds to and
+// removes from authorized_keys, which are recorded in the journal of the index
+// rather than reading the whole file again.
+type keyChange struct {
+	keyindex.Change
+}
+
+func (k *keyChange) add(line string) {
+	for _, key := range indexKeys(line) {
+		k.Put(key, line)
+	}
+}
+
+func (k *keyChange) remove(line string) {
+	for _, key := range indexKeys(line) {
+		k.Delete(key)
+	}
+}
+
+// openFreshIndex opens the index, unless it is disabled or doesn't match
+// authorized_keys. The lock must be held.
+func (c *Command) openFreshIndex() *keyindex.Index {
+	if !c.Config.AuthorizedKeysIndex.Enabled {
+		return nil
+	}
+
+	index, err := keyindex.Open(c.Config.AuthorizedKeysIndex.Path)
+	if err != nil {
+		return nil
+	}
+
+	if fresh, err := index.Fresh(c.Config.AuthFile); err != nil || !fresh {
+		index.Close()
+		return nil
+	}
+
+	return index
+}
+
+// recordIndex records change in the journal of index, which was fresh before
+// the change. The index is rebuilt when that isn't possible: there was no
+// fresh index, the change failed half way or the journal is full. The lock
+// must be held.
+func (c *Command) recordIndex(index *keyindex.Index, change *keyChange, changeErr error) error {
+	if !c.Config.AuthorizedKeysIndex.Enabled {
+		return nil
+	}
+
+	if index == nil {
+		return c.updateIndex()
+	}
+
+	if changeErr != nil {
+		// Failed before touching authorized_keys
+		if fresh, err := index.Fresh(c.Config.AuthFile); err == nil && fresh {
+			return nil
+		}
+
+		return c.updateIndex()
+	}
+
+	info, err := os.Stat(c.Config.AuthFile)
+	if err == nil {
+		err = index.Record(&change.Change, info)
+	}
+
+	if err != nil {
+		logger.Info("Rebuilding the authorized_keys index", map[string]interface{}{"error": err.Error()})
+		return c.updateIndex()
+	}
+
+	return nil
+}
+
+// updateIndex rebuilds the index of authorized_keys after a batch change. An
+// index that can't be rebuilt is removed, a stale one would keep removed keys
+// working. The lock must be held.
+func (c *Command) updateIndex() error {
+	if !c.Config.AuthorizedKeysIndex.Enabled {
+		return nil
+	}
+
+	count, err := c.buildIndex()
+	if err != nil {
+		keyindex.Remove(c.Config.AuthorizedKeysIndex.Path)
+		logger.Warn("Removed the authorized_keys index", map[string]interface{}{"error": err.Error()})
+
+		return err
+	}
+
+	logger.Info("Rebuilt the authorized_keys index", map[string]interface{}{"keys": count})
+
+	return nil
+}
+
+// buildIndex maps the indexKeys of every line to the line
+func (c *Command) buildIndex() (int, error) {
+	file, err := os.Open(c.Config.AuthFile)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	writer, err := keyindex.Create(c.Config.AuthorizedKeysIndex.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer writer.Abort()
+
+	if err := writer.SetSource(info); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var addErr error
+
+	err = eachLine(file, func(line string) {
+		keys := indexKeys(line)
+		if len(keys) == 0 || addErr != nil {
+			return
+		}
+
+		for _, key := range keys {
+			if addErr == nil {
+				addErr = writer.Add(key, line)
+			}
+		}
+		count++
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if addErr != nil {
+		return 0, addErr
+	}
+
+	return count, writer.Commit()
+}
+
+// indexKeys returns what the index maps to a line of authorized_keys: the
+// base64 blob and the fingerprint of its key, as sshd passes them to
+// AuthorizedKeysCommand. Only the lines of keys are indexed.
+func indexKeys(line string) []string {
+	who, key, ok := parseManagedLine(line)
+	if !ok || !strings.HasPrefix(who, "key-") {
+		return nil
+	}
+
+	keys := []string{strings.Fields(key)[1]}
+	if parsedKey, err := sshkey.Parse(key); err == nil {
+		keys = append(keys, parsedKey.Fingerprint())
+	}
+
+	return keys
+}
@@ -0,0 +1,210 @@
+package gitlabkeys
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/keyindex"
+)
+
+const (
+	// ssh-keygen -l -E sha256
+	fingerprintA = "SHA256:Qz6XIlUPD2dqbMwqwJEZpF3H1PXhD7XXSggHWedbLlI"
+	fingerprintB = "SHA256:/kHiWdpktxUg0QqcYztiE6LffyWbIcBfM3yprOyvCP8"
+)
+
+func executeIndexed(authFile string, input string, arguments ...string) error {
+	cmd := &Command{
+		Config: &config.Config{
+			RootDir:             "/tmp",
+			AuthFile:            authFile,
+			AuthorizedKeysIndex: config.AuthorizedKeysIndexConfig{Enabled: true, Path: authFile + ".index"},
+		},
+		Args: commandargs.ParseGitlabKeys(arguments),
+	}
+
+	return cmd.Execute(&readwriter.ReadWriter{In: strings.NewReader(input), Out: &bytes.Buffer{}})
+}
+
+// requireIndexed checks that the index matches authorized_keys and what it
+// answers for the keys in expected, an empty line meaning no answer.
+func requireIndexed(t *testing.T, authFile string, expected map[string]string) {
+	index, err := keyindex.Open(authFile + ".index")
+	require.NoError(t, err)
+	defer index.Close()
+
+	fresh, err := index.Fresh(authFile)
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	for blob, expectedLine := range expected {
+		line, found, err := index.Get(blob)
+		require.NoError(t, err)
+		require.Equal(t, expectedLine != "", found, blob)
+		require.Equal(t, expectedLine, line)
+	}
+}
+
+func requireNoIndex(t *testing.T, authFile string) {
+	_, err := os.Stat(authFile + ".index")
+	require.True(t, os.IsNotExist(err))
+}
+
+func requireJournal(t *testing.T, authFile string, exists bool) {
+	_, err := os.Stat(authFile + ".index.journal")
+	require.Equal(t, exists, err == nil)
+}
+
+func TestIndex(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	require.NoError(t, executeIndexed(authFile, "key-741\t"+keyA+"\n", "batch-add-keys"))
+	requireIndexed(t, authFile, map[string]string{blobA: line741, blobB: "", fingerprintA: line741})
+	requireJournal(t, authFile, false)
+
+	// Changes of a single key go to the journal
+	require.NoError(t, executeIndexed(authFile, "", "add-key", "key-742", keyB))
+	requireIndexed(t, authFile, map[string]string{blobA: line741, blobB: line742, fingerprintB: line742})
+	requireJournal(t, authFile, true)
+
+	require.NoError(t, executeIndexed(authFile, "", "rm-key", "key-741"))
+	requireIndexed(t, authFile, map[string]string{blobA: "", fingerprintA: "", blobB: line742})
+
+	// Removing a key that isn't there still is a change of authorized_keys
+	require.NoError(t, executeIndexed(authFile, "", "rm-key", "key-741"))
+	requireIndexed(t, authFile, map[string]string{blobA: "", blobB: line742})
+
+	require.NoError(t, executeIndexed(authFile, "", "add-key", "key-741", keyA))
+	requireIndexed(t, authFile, map[string]string{blobA: line741, fingerprintA: line741, blobB: line742})
+
+	// Batch changes rebuild the index and drop the journal
+	require.NoError(t, executeIndexed(authFile, "", "compact"))
+	requireIndexed(t, authFile, map[string]string{blobA: line741, blobB: line742})
+	requireJournal(t, authFile, false)
+
+	require.NoError(t, executeIndexed(authFile, "", "clear"))
+	requireIndexed(t, authFile, map[string]string{blobA: "", blobB: ""})
+}
+
+func TestIndexSurvivesCompactionByRmKey(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	cmd := &Command{
+		Config: &config.Config{
+			RootDir:             "/tmp",
+			AuthFile:            authFile,
+			AuthorizedKeysIndex: config.AuthorizedKeysIndexConfig{Enabled: true, Path: authFile + ".index"},
+			GitlabKeys:          config.GitlabKeysConfig{CompactThreshold: 0.5},
+		},
+		Args: commandargs.ParseGitlabKeys([]string{"rm-key", "key-741"}),
+	}
+
+	require.NoError(t, executeIndexed(authFile, "key-741\t"+keyA+"\nkey-742\t"+keyB+"\n", "batch-add-keys"))
+	require.NoError(t, cmd.Execute(&readwriter.ReadWriter{Out: &bytes.Buffer{}}))
+
+	requireContent(t, authFile, line742+"\n")
+	requireIndexed(t, authFile, map[string]string{blobA: "", blobB: line742})
+}
+
+func TestIndexIsRebuiltWhenStale(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	require.NoError(t, executeIndexed(authFile, "key-741\t"+keyA+"\n", "batch-add-keys"))
+
+	// Such as the Ruby gitlab-keys, which doesn't know about the index
+	appendLine(t, authFile, line742)
+
+	require.NoError(t, executeIndexed(authFile, "", "rm-key", "key-741"))
+	requireIndexed(t, authFile, map[string]string{blobA: "", blobB: line742})
+	requireJournal(t, authFile, false)
+}
+
+func TestIndexIsRebuiltWhenTheJournalIsFull(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	require.NoError(t, executeIndexed(authFile, "", "batch-add-keys"))
+
+	// The journal starts over once the index is rebuilt
+	var size int64
+	for i := 0; ; i++ {
+		require.True(t, i < 1000, "the journal is never full")
+
+		require.NoError(t, executeIndexed(authFile, "", "add-key", "key-741", keyA))
+		require.NoError(t, executeIndexed(authFile, "", "rm-key", "key-741"))
+
+		info, err := os.Stat(authFile + ".index.journal")
+		if os.IsNotExist(err) || info.Size() < size {
+			break
+		}
+		require.NoError(t, err)
+		size = info.Size()
+	}
+
+	requireIndexed(t, authFile, map[string]string{blobA: ""})
+
+	require.NoError(t, executeIndexed(authFile, "", "add-key", "key-741", keyA))
+	requireIndexed(t, authFile, map[string]string{blobA: line741})
+	requireJournal(t, authFile, true)
+}
+
+func TestIndexIsFreshUntilAuthFileChanges(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	require.NoError(t, executeIndexed(authFile, "key-741\t"+keyA+"\n", "batch-add-keys"))
+
+	index, err := keyindex.Open(authFile + ".index")
+	require.NoError(t, err)
+	defer index.Close()
+
+	fresh, err := index.Fresh(authFile)
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	appendLine(t, authFile, line742)
+
+	fresh, err = index.Fresh(authFile)
+	require.NoError(t, err)
+	require.False(t, fresh)
+}
+
+func TestIndexIsRemovedWhenItCantBeUpdated(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	require.NoError(t, executeIndexed(authFile, "key-741\t"+keyA+"\n", "batch-add-keys"))
+	require.NoError(t, os.Remove(authFile))
+
+	require.Error(t, executeIndexed(authFile, "", "compact"))
+	requireNoIndex(t, authFile)
+}
+
+func TestIndexIsNotWrittenWhenDisabled(t *testing.T) {
+	authFile, cleanup := setup(t, "")
+	defer cleanup()
+
+	_, err := execute(authFile, "key-741\t"+keyA+"\n", "batch-add-keys")
+	require.NoError(t, err)
+
+	requireNoIndex(t, authFile)
+}
+
+func appendLine(t *testing.T, path, line string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.WriteString(line + "\n")
+	require.NoError(t, err)
+}
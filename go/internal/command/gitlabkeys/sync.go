@@ -0,0 +1,217 @@
+package gitlabkeys
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+const (
+	perPage = 1000
+)
+
+var (
+	ErrNoCursor = errors.New("No sync cursor found, run gitlab-keys rebuild first")
+
+	lineKeyIdRegex = regexp.MustCompile(`^command="[^"]* key-(\d+)"`)
+)
+
+// rebuild writes a fresh authorized_keys file with every key known to the
+// API, and stores the cursor that sync starts from.
+func (c *Command) rebuild() error {
+	client, err := authorizedkeys.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	return c.withLock(batchLockTimeout, func() error {
+		var cursor string
+		count := 0
+
+		err := c.replaceAuthFile(func(w io.Writer) error {
+			fmt.Fprintln(w, ManagedHeader)
+
+			var lastId int64
+			for first := true; ; first = false {
+				keysPage, err := client.List(lastId, perPage)
+				if err != nil {
+					return err
+				}
+
+				// Changes made while paging are caught up by the next sync
+				if first {
+					cursor = keysPage.Cursor
+				}
+
+				for _, key := range keysPage.Keys {
+					if key.Id <= lastId {
+						return fmt.Errorf("Keys listed out of order: %d after %d", key.Id, lastId)
+					}
+					lastId = key.Id
+
+					if c.writeKey(w, key) {
+						count++
+					}
+				}
+
+				if !keysPage.More || len(keysPage.Keys) == 0 {
+					return nil
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		logger.Info("Rebuilt authorized_keys", map[string]interface{}{"keys": count})
+
+		return c.writeCursor(cursor)
+	})
+}
+
+// sync applies the keys added and removed since the stored cursor
+func (c *Command) sync() error {
+	client, err := authorizedkeys.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	return c.withLock(batchLockTimeout, func() error {
+		cursor, err := c.readCursor()
+		if err != nil {
+			return err
+		}
+
+		// A nil key means it was removed
+		changes := make(map[int64]*authorizedkeys.Response)
+
+		for {
+			page, err := client.Changes(cursor)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range page.Removed {
+				changes[id] = nil
+			}
+
+			for _, key := range page.Added {
+				changes[key.Id] = key
+			}
+
+			cursor = page.Cursor
+			if !page.More {
+				break
+			}
+		}
+
+		if len(changes) > 0 {
+			if err := c.applyChanges(changes); err != nil {
+				return err
+			}
+		}
+
+		logger.Info("Synced authorized_keys", map[string]interface{}{"changed_keys": len(changes)})
+
+		return c.writeCursor(cursor)
+	})
+}
+
+func (c *Command) applyChanges(changes map[int64]*authorizedkeys.Response) error {
+	file, err := os.Open(c.Config.AuthFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return c.replaceAuthFile(func(w io.Writer) error {
+		// Lines of changed keys are dropped, added keys are appended below
+		err := eachLine(file, func(line string) {
+			if id, ok := lineKeyId(line); ok {
+				if _, changed := changes[id]; changed {
+					return
+				}
+			}
+
+			io.WriteString(w, line+"\n")
+		})
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for id, key := range changes {
+			if key != nil {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		for _, id := range ids {
+			c.writeKey(w, changes[id])
+		}
+
+		return nil
+	})
+}
+
+// writeKey writes the line of a key, skipping keys that can't be written
+// so that a single bad key doesn't block everyone else.
+func (c *Command) writeKey(w io.Writer, key *authorizedkeys.Response) bool {
+	keyLine, err := key.KeyLine(c.Config.RootDir)
+	if err == nil {
+		err = c.checkKey(key.Key)
+	}
+
+	if err != nil {
+		logger.Warn("Skipping invalid key", map[string]interface{}{"key_id": key.Id, "error": err.Error()})
+		return false
+	}
+
+	fmt.Fprintln(w, keyLine.ToString())
+
+	return true
+}
+
+func (c *Command) cursorFile() string {
+	return c.Config.AuthFile + ".cursor"
+}
+
+func (c *Command) readCursor() (string, error) {
+	content, err := ioutil.ReadFile(c.cursorFile())
+	if os.IsNotExist(err) {
+		return "", ErrNoCursor
+	} else if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (c *Command) writeCursor(cursor string) error {
+	return replaceFile(c.cursorFile(), func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, cursor)
+		return err
+	})
+}
+
+// lineKeyId returns the id of the key a line of authorized_keys is for
+func lineKeyId(line string) (int64, bool) {
+	matches := lineKeyIdRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(matches[1], 10, 64)
+
+	return id, err == nil
+}
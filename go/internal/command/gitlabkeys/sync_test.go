@@ -0,0 +1,123 @@
+package gitlabkeys
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	syncRequests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/authorized_keys/list",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Query().Get("after_id") {
+				case "0":
+					json.NewEncoder(w).Encode(&authorizedkeys.KeysPage{
+						Keys:   []*authorizedkeys.Response{{Id: 1, Key: keyA}, {Id: 2, Key: "ssh-rsa BB\nBB"}},
+						Cursor: "10",
+						More:   true,
+					})
+				case "2":
+					json.NewEncoder(w).Encode(&authorizedkeys.KeysPage{
+						Keys:   []*authorizedkeys.Response{{Id: 3, Key: keyC}},
+						Cursor: "11",
+					})
+				}
+			},
+		},
+		{
+			Path: "/api/v4/internal/authorized_keys/changes",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Query().Get("cursor") {
+				case "10":
+					json.NewEncoder(w).Encode(&authorizedkeys.ChangesPage{
+						Added:   []*authorizedkeys.Response{{Id: 4, Key: keyD}, {Id: 5, Key: keyE}},
+						Removed: []int64{1},
+						Cursor:  "12",
+						More:    true,
+					})
+				case "12":
+					json.NewEncoder(w).Encode(&authorizedkeys.ChangesPage{
+						Added:   []*authorizedkeys.Response{{Id: 3, Key: keyB}},
+						Removed: []int64{5},
+						Cursor:  "13",
+					})
+				case "13":
+					json.NewEncoder(w).Encode(&authorizedkeys.ChangesPage{Cursor: "13"})
+				default:
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			},
+		},
+	}
+)
+
+func keyLine(id int, key string) string {
+	return fmt.Sprintf(`command="/tmp/bin/gitlab-shell key-%d",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty %s`, id, key) + "\n"
+}
+
+func executeWithApi(t *testing.T, url, authFile, subcommand string) error {
+	cmd := &Command{
+		Config: &config.Config{RootDir: "/tmp", AuthFile: authFile, GitlabUrl: url},
+		Args:   &commandargs.GitlabKeys{Subcommand: subcommand},
+	}
+
+	return cmd.Execute(&readwriter.ReadWriter{Out: &bytes.Buffer{}})
+}
+
+func TestRebuildAndSync(t *testing.T) {
+	cleanupServer, url, err := testserver.StartSocketHttpServer(syncRequests)
+	require.NoError(t, err)
+	defer cleanupServer()
+
+	authFile, cleanup := setup(t, "# Managed by gitlab-shell\n"+keyLine(9, "ssh-rsa ZZZZ"))
+	defer cleanup()
+
+	require.Equal(t, ErrNoCursor, executeWithApi(t, url, authFile, "sync"))
+
+	require.NoError(t, executeWithApi(t, url, authFile, "rebuild"))
+	requireContent(t, authFile, "# Managed by gitlab-shell\n"+keyLine(1, keyA)+keyLine(3, keyC))
+	requireCursor(t, authFile, "10")
+
+	require.NoError(t, executeWithApi(t, url, authFile, "sync"))
+	requireContent(t, authFile, "# Managed by gitlab-shell\n"+keyLine(3, keyB)+keyLine(4, keyD))
+	requireCursor(t, authFile, "13")
+
+	require.NoError(t, executeWithApi(t, url, authFile, "sync"))
+	requireContent(t, authFile, "# Managed by gitlab-shell\n"+keyLine(3, keyB)+keyLine(4, keyD))
+}
+
+func TestFailingSyncKeepsState(t *testing.T) {
+	cleanupServer, url, err := testserver.StartSocketHttpServer(syncRequests)
+	require.NoError(t, err)
+	defer cleanupServer()
+
+	authFile, cleanup := setup(t, "# Managed by gitlab-shell\n")
+	defer cleanup()
+	require.NoError(t, ioutil.WriteFile(authFile+".cursor", []byte("unknown\n"), 0600))
+
+	require.EqualError(t, executeWithApi(t, url, authFile, "sync"), "Internal API error (400)")
+
+	content, err := ioutil.ReadFile(authFile)
+	require.NoError(t, err)
+	require.Equal(t, "# Managed by gitlab-shell\n", string(content))
+	requireCursor(t, authFile, "unknown")
+}
+
+func requireCursor(t *testing.T, authFile, expected string) {
+	content, err := ioutil.ReadFile(authFile + ".cursor")
+	require.NoError(t, err)
+	require.Equal(t, expected+"\n", string(content))
+}
@@ -0,0 +1,127 @@
+package gitlabkeys
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/sshkey"
+)
+
+const (
+	ProblemMissing    = "missing"
+	ProblemStale      = "stale"
+	ProblemDuplicated = "duplicated"
+	ProblemMalformed  = "malformed"
+)
+
+// Problem is a line of authorized_keys that doesn't match what GitLab knows
+type Problem struct {
+	Type    string `json:"type"`
+	Line    int    `json:"line"`
+	KeyId   string `json:"key_id,omitempty"`
+	Message string `json:"message"`
+}
+
+type VerifyReport struct {
+	Checked  int        `json:"checked"`
+	Problems []*Problem `json:"problems"`
+}
+
+// verify checks every managed line against the /authorized_keys lookup, and
+// fails when any drift was found.
+func (c *Command) verify(out io.Writer) error {
+	client, err := authorizedkeys.NewClient(c.Config)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(c.Config.AuthFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report := &VerifyReport{Problems: []*Problem{}}
+	seen := make(map[string]int)
+	lineNumber := 0
+	var lookupErr error
+
+	err = eachLine(file, func(line string) {
+		lineNumber++
+
+		if lookupErr != nil || !strings.HasPrefix(line, "command=") {
+			return
+		}
+
+		report.Checked++
+
+		problem, err := c.verifyLine(client, line, lineNumber, seen)
+		if err != nil {
+			lookupErr = err
+		} else if problem != nil {
+			report.Problems = append(report.Problems, problem)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Without an answer from GitLab there is nothing to report on
+	if lookupErr != nil {
+		return lookupErr
+	}
+
+	if c.Args.Json {
+		json.NewEncoder(out).Encode(report)
+	} else {
+		for _, problem := range report.Problems {
+			fmt.Fprintf(out, "%s line %d: %s\n", problem.Type, problem.Line, problem.Message)
+		}
+		fmt.Fprintf(out, "%d keys checked, %d problems found\n", report.Checked, len(report.Problems))
+	}
+
+	if len(report.Problems) > 0 {
+		return ErrFailed
+	}
+
+	return nil
+}
+
+func (c *Command) verifyLine(client *authorizedkeys.Client, line string, lineNumber int, seen map[string]int) (*Problem, error) {
+	keyId, publicKey, ok := parseManagedLine(line)
+	id, hasId := lineKeyId(line)
+	if !ok || !hasId {
+		return &Problem{Type: ProblemMalformed, Line: lineNumber, Message: "unparseable line"}, nil
+	}
+
+	key, err := sshkey.Parse(publicKey)
+	if err != nil {
+		return &Problem{Type: ProblemMalformed, Line: lineNumber, KeyId: keyId, Message: err.Error()}, nil
+	}
+
+	if firstLine, duplicated := seen[keyId]; duplicated {
+		return &Problem{Type: ProblemDuplicated, Line: lineNumber, KeyId: keyId, Message: fmt.Sprintf("%s already on line %d", keyId, firstLine)}, nil
+	}
+	seen[keyId] = lineNumber
+
+	response, err := client.GetByKey(base64.StdEncoding.EncodeToString(key.Blob))
+	if apiError, ok := err.(*gitlabnet.ApiError); ok && apiError.StatusCode == http.StatusNotFound {
+		return &Problem{Type: ProblemMissing, Line: lineNumber, KeyId: keyId, Message: fmt.Sprintf("%s is unknown to GitLab", keyId)}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Key lookup failed on line %d: %v", lineNumber, err)
+	}
+
+	if response.Id != id {
+		return &Problem{Type: ProblemStale, Line: lineNumber, KeyId: keyId, Message: fmt.Sprintf("GitLab has this key as key-%s", strconv.FormatInt(response.Id, 10))}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,99 @@
+package gitlabkeys
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/authorizedkeys"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	verifyRequests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/authorized_keys",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Query().Get("key") {
+				case blobA:
+					json.NewEncoder(w).Encode(&authorizedkeys.Response{Id: 1, Key: keyA})
+				case blobB:
+					json.NewEncoder(w).Encode(&authorizedkeys.Response{Id: 20, Key: keyB})
+				case blobE:
+					w.WriteHeader(http.StatusInternalServerError)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			},
+		},
+	}
+)
+
+func verify(t *testing.T, content string, json bool) (string, error) {
+	cleanupServer, url, err := testserver.StartSocketHttpServer(verifyRequests)
+	require.NoError(t, err)
+	defer cleanupServer()
+
+	authFile, cleanup := setup(t, content)
+	defer cleanup()
+
+	cmd := &Command{
+		Config: &config.Config{RootDir: "/tmp", AuthFile: authFile, GitlabUrl: url},
+		Args:   &commandargs.GitlabKeys{Subcommand: "verify", Json: json},
+	}
+
+	output := &bytes.Buffer{}
+	err = cmd.Execute(&readwriter.ReadWriter{Out: output})
+
+	return output.String(), err
+}
+
+func TestVerifyWithoutDrift(t *testing.T) {
+	output, err := verify(t, "# Managed by gitlab-shell\n"+keyLine(1, keyA+" comment")+strings.Repeat("#", 10)+"\n", false)
+
+	require.NoError(t, err)
+	require.Equal(t, "1 keys checked, 0 problems found\n", output)
+}
+
+func TestVerifyReportsDrift(t *testing.T) {
+	content := "# Managed by gitlab-shell\n" +
+		keyLine(1, keyA) +
+		keyLine(2, keyB) +
+		keyLine(3, keyC) +
+		keyLine(1, keyA) +
+		"command=\"/tmp/bin/gitlab-shell\" garbage\n" +
+		keyLine(4, "ssh-rsa AAAA")
+
+	output, err := verify(t, content, false)
+
+	require.Equal(t, ErrFailed, err)
+	require.Equal(t, "stale line 3: GitLab has this key as key-20\n"+
+		"missing line 4: key-3 is unknown to GitLab\n"+
+		"duplicated line 5: key-1 already on line 2\n"+
+		"malformed line 6: unparseable line\n"+
+		"malformed line 7: Invalid key: truncated key blob\n"+
+		"6 keys checked, 5 problems found\n", output)
+
+	output, err = verify(t, content, true)
+
+	require.Equal(t, ErrFailed, err)
+
+	report := &VerifyReport{}
+	require.NoError(t, json.Unmarshal([]byte(output), report))
+	require.Equal(t, 6, report.Checked)
+	require.Equal(t, &Problem{Type: ProblemStale, Line: 3, KeyId: "key-2", Message: "GitLab has this key as key-20"}, report.Problems[0])
+	require.Len(t, report.Problems, 5)
+}
+
+func TestVerifyWithFailingApi(t *testing.T) {
+	_, err := verify(t, keyLine(1, keyE), false)
+
+	require.EqualError(t, err, "Key lookup failed on line 1: Internal API error (500)")
+}
@@ -0,0 +1,108 @@
+package lfsauthenticate
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/disallowedcommand"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/lfsauthenticate"
+)
+
+const (
+	downloadAction = "download"
+	uploadAction   = "upload"
+)
+
+type Command struct {
+	Config *config.Config
+	Args   *commandargs.CommandArgs
+}
+
+type PayloadHeader struct {
+	Auth string `json:"Authorization"`
+}
+
+// Payload is the git-lfs server discovery response, see
+// https://github.com/git-lfs/git-lfs/blob/master/docs/api/server-discovery.md#ssh
+type Payload struct {
+	Header    PayloadHeader `json:"header"`
+	Href      string        `json:"href"`
+	ExpiresIn int           `json:"expires_in,omitempty"`
+}
+
+func (c *Command) Execute(readWriter *readwriter.ReadWriter) error {
+	args := c.Args.SshArgs
+	if len(args) < 3 {
+		return disallowedcommand.Error
+	}
+
+	repo := args[1]
+	operation := args[2]
+
+	action, err := ActionFromOperation(operation)
+	if err != nil {
+		return err
+	}
+
+	accessResponse, err := c.verifyAccess(readWriter, action, repo)
+	if err != nil {
+		return err
+	}
+
+	payload, err := c.authenticate(operation, repo, accessResponse.UserId)
+	if err != nil {
+		// return nothing just like Ruby's GitlabShell#lfs_authenticate does
+		return nil
+	}
+
+	fmt.Fprintf(readWriter.Out, "%s\n", payload)
+
+	return nil
+}
+
+// ActionFromOperation maps an LFS operation onto the Git command whose
+// access check applies to it.
+func ActionFromOperation(operation string) (commandargs.CommandType, error) {
+	var action commandargs.CommandType
+
+	switch operation {
+	case downloadAction:
+		action = commandargs.UploadPack
+	case uploadAction:
+		action = commandargs.ReceivePack
+	default:
+		return "", disallowedcommand.Error
+	}
+
+	return action, nil
+}
+
+func (c *Command) verifyAccess(readWriter *readwriter.ReadWriter, action commandargs.CommandType, repo string) (*accessverifier.Response, error) {
+	cmd := accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: readWriter}
+
+	return cmd.Verify(action, repo)
+}
+
+func (c *Command) authenticate(operation, repo, userId string) ([]byte, error) {
+	client, err := lfsauthenticate.NewClient(c.Config, c.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Authenticate(operation, repo, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &Payload{
+		Header:    PayloadHeader{Auth: response.Authorization()},
+		Href:      response.RepoPath + "/info/lfs",
+		ExpiresIn: response.ExpiresIn,
+	}
+
+	return json.Marshal(payload)
+}
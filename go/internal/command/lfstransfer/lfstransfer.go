@@ -0,0 +1,95 @@
+package lfstransfer
+
+import (
+	"io"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/lfsauthenticate"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/disallowedcommand"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	lfsauthenticateclient "gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/lfsauthenticate"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/lfstransfer"
+)
+
+// Command implements the server side of the Git LFS SSH transfer protocol,
+// see https://github.com/git-lfs/git-lfs/blob/master/docs/proposals/ssh_adapter.md
+// Every operation is proxied to the LFS API of the repository, using the
+// same access check and token as git-lfs-authenticate.
+type Command struct {
+	Config *config.Config
+	Args   *commandargs.CommandArgs
+}
+
+func (c *Command) Execute(readWriter *readwriter.ReadWriter) error {
+	args := c.Args.SshArgs
+	if len(args) != 3 {
+		return disallowedcommand.Error
+	}
+
+	repo := args[1]
+	operation := args[2]
+
+	action, err := lfsauthenticate.ActionFromOperation(operation)
+	if err != nil {
+		return err
+	}
+
+	accessResponse, err := c.verifyAccess(readWriter, action, repo)
+	if err != nil {
+		return err
+	}
+
+	client, err := c.lfsClient(operation, repo, accessResponse.UserId)
+	if err != nil {
+		return err
+	}
+
+	s := newSession(operation, client, readWriter.In, readWriter.Out)
+
+	return s.serve()
+}
+
+func (c *Command) verifyAccess(readWriter *readwriter.ReadWriter, action commandargs.CommandType, repo string) (*accessverifier.Response, error) {
+	cmd := accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: readWriter}
+
+	return cmd.Verify(action, repo)
+}
+
+func (c *Command) lfsClient(operation, repo, userId string) (*lfstransfer.Client, error) {
+	client, err := lfsauthenticateclient.NewClient(c.Config, c.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Authenticate(operation, repo, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	renew := func() (*lfstransfer.Token, error) {
+		response, err := client.Authenticate(operation, repo, userId)
+		if err != nil {
+			return nil, err
+		}
+
+		return lfsToken(response), nil
+	}
+
+	return lfstransfer.NewClient(c.Config.GetExternalHttpClient(), response.RepoPath+"/info/lfs", lfsToken(response), renew), nil
+}
+
+func lfsToken(response *lfsauthenticateclient.Response) *lfstransfer.Token {
+	return &lfstransfer.Token{Authorization: response.Authorization(), ExpiresIn: response.ExpiresIn}
+}
+
+func newSession(operation string, client *lfstransfer.Client, in io.Reader, out io.Writer) *session {
+	return &session{
+		operation: operation,
+		client:    client,
+		reader:    &pktReader{r: in},
+		writer:    &pktWriter{w: out},
+		objects:   make(map[string]*lfstransfer.BatchObject),
+	}
+}
@@ -0,0 +1,263 @@
+package lfstransfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/lfstransfer"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+const (
+	existingOid = "aaaa"
+	newOid      = "bbbb"
+	objectData  = "hello"
+	auth        = "Basic am9objpzb21ldG9rZW4="
+)
+
+var (
+	flush = "0000"
+	delim = "0001"
+)
+
+func pkt(lines ...string) string {
+	var out string
+	for _, line := range lines {
+		out += fmt.Sprintf("%04x%s\n", len(line)+5, line)
+	}
+	return out
+}
+
+func setup(t *testing.T, uploaded *bytes.Buffer) (string, func()) {
+	var url string
+
+	lfsPath := "/group/repo.git/info/lfs"
+	lock := &lfstransfer.Lock{Id: "1", Path: "file.bin", LockedAt: "2019-06-01T00:00:00Z", Owner: &lfstransfer.LockOwner{Name: "John"}}
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request map[string]interface{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				if request["key_id"] == "2" {
+					json.NewEncoder(w).Encode(map[string]interface{}{"status": false, "message": "Access denied"})
+					return
+				}
+
+				json.NewEncoder(w).Encode(map[string]interface{}{"status": true, "gl_id": "user-1"})
+			},
+		},
+		{
+			Path: "/api/v4/internal/lfs_authenticate",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"username":             "john",
+					"lfs_token":            "sometoken",
+					"repository_http_path": url + "/group/repo.git",
+				})
+			},
+		},
+		{
+			Path: lfsPath + "/objects/batch",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, auth, r.Header.Get("Authorization"))
+
+				var request lfstransfer.BatchRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				for _, object := range request.Objects {
+					switch {
+					case object.Oid == newOid && request.Operation == "upload":
+						object.Actions = map[string]*lfstransfer.Action{
+							"upload": {Href: url + "/upload/" + newOid, Header: map[string]string{"Authorization": "upload-token"}},
+							"verify": {Href: url + "/verify"},
+						}
+					case object.Oid == existingOid && request.Operation == "download":
+						object.Actions = map[string]*lfstransfer.Action{
+							"download": {Href: url + "/download/" + existingOid},
+						}
+					}
+				}
+
+				json.NewEncoder(w).Encode(&lfstransfer.BatchResponse{Transfer: "basic", Objects: request.Objects})
+			},
+		},
+		{
+			Path: "/upload/" + newOid,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "PUT", r.Method)
+				require.Equal(t, "upload-token", r.Header.Get("Authorization"))
+
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+				uploaded.Write(b)
+			},
+		},
+		{
+			Path: "/verify",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request lfstransfer.VerifyRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				require.Equal(t, newOid, request.Oid)
+			},
+		},
+		{
+			Path: "/download/" + existingOid,
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(objectData))
+			},
+		},
+		{
+			Path: lfsPath + "/locks",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == "GET" {
+					json.NewEncoder(w).Encode(&lfstransfer.LockList{Locks: []*lfstransfer.Lock{lock}})
+					return
+				}
+
+				var request lfstransfer.LockRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+				if request.Path == lock.Path {
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(map[string]interface{}{"lock": lock, "message": "already locked"})
+					return
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(&lfstransfer.LockResponse{Lock: &lfstransfer.Lock{Id: "2", Path: request.Path, LockedAt: lock.LockedAt, Owner: lock.Owner}})
+			},
+		},
+		{
+			Path: lfsPath + "/locks/verify",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(&lfstransfer.LockVerifyList{Ours: []*lfstransfer.Lock{lock}, NextCursor: "next"})
+			},
+		},
+		{
+			Path: lfsPath + "/locks/1/unlock",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request lfstransfer.UnlockRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				require.True(t, request.Force)
+
+				json.NewEncoder(w).Encode(&lfstransfer.LockResponse{Lock: lock})
+			},
+		},
+	}
+
+	cleanup, serverUrl, err := testserver.StartHttpServer(requests)
+	require.NoError(t, err)
+	url = serverUrl
+
+	return url, cleanup
+}
+
+func execute(t *testing.T, url, keyId, operation, input string) (string, error) {
+	cmd := &Command{
+		Config: &config.Config{GitlabUrl: url},
+		Args:   &commandargs.CommandArgs{GitlabKeyId: keyId, SshArgs: []string{"git-lfs-transfer", "group/repo", operation}},
+	}
+
+	output := &bytes.Buffer{}
+	err := cmd.Execute(&readwriter.ReadWriter{In: bytes.NewBufferString(input), Out: output, ErrOut: output})
+
+	return output.String(), err
+}
+
+func TestUpload(t *testing.T) {
+	uploaded := &bytes.Buffer{}
+	url, cleanup := setup(t, uploaded)
+	defer cleanup()
+
+	input := pkt("version 1") + flush +
+		pkt("batch", "transfer=basic", "hash-algo=sha256", "refname=refs/heads/main") + delim +
+		pkt(newOid+" 5", existingOid+" 3") + flush +
+		pkt("put-object "+newOid, "size=5") + delim + fmt.Sprintf("%04x%s", len(objectData)+4, objectData) + flush +
+		pkt("verify-object "+newOid, "size=5") + flush +
+		pkt("quit") + flush
+
+	output, err := execute(t, url, "1", "upload", input)
+	require.NoError(t, err)
+
+	expected := pkt("version=1", "locking") + flush +
+		pkt("status 200") + flush +
+		pkt("status 200", "transfer=basic", "hash-algo=sha256") + delim + pkt(newOid+" 5 upload", existingOid+" 3 noop") + flush +
+		pkt("status 200") + flush +
+		pkt("status 200") + flush +
+		pkt("status 200") + flush
+
+	require.Equal(t, expected, output)
+	require.Equal(t, objectData, uploaded.String())
+}
+
+func TestDownload(t *testing.T) {
+	url, cleanup := setup(t, &bytes.Buffer{})
+	defer cleanup()
+
+	input := pkt("version 1") + flush +
+		pkt("get-object "+existingOid) + flush +
+		pkt("get-object "+newOid) + flush +
+		pkt("put-object "+newOid, "size=5") + delim + fmt.Sprintf("%04x%s", len(objectData)+4, objectData) + flush +
+		pkt("quit") + flush
+
+	output, err := execute(t, url, "1", "download", input)
+	require.NoError(t, err)
+
+	expected := pkt("version=1", "locking") + flush +
+		pkt("status 200") + flush +
+		pkt("status 200", "size=5") + delim + fmt.Sprintf("%04x%s", len(objectData)+4, objectData) + flush +
+		pkt("status 404") + delim + pkt("object not found") + flush +
+		pkt("status 403") + delim + pkt("not an upload session") + flush +
+		pkt("status 200") + flush
+
+	require.Equal(t, expected, output)
+}
+
+func TestLocking(t *testing.T) {
+	url, cleanup := setup(t, &bytes.Buffer{})
+	defer cleanup()
+
+	input := pkt("lock", "path=new.bin") + flush +
+		pkt("lock", "path=file.bin") + flush +
+		pkt("list-lock", "path=file.bin") + flush +
+		pkt("list-lock", "refname=refs/heads/main") + flush +
+		pkt("unlock 1", "force=true") + flush
+
+	output, err := execute(t, url, "1", "upload", input)
+	require.NoError(t, err)
+
+	lockArgs := []string{"id=1", "path=file.bin", "locked-at=2019-06-01T00:00:00Z", "ownername=John"}
+	lockLines := []string{"lock 1", "path 1 file.bin", "locked-at 1 2019-06-01T00:00:00Z", "ownername 1 John"}
+
+	expected := pkt("version=1", "locking") + flush +
+		pkt("status 201", "id=2", "path=new.bin", "locked-at=2019-06-01T00:00:00Z", "ownername=John") + flush +
+		pkt(append([]string{"status 409"}, lockArgs...)...) + delim + pkt("already locked") + flush +
+		pkt("status 200") + delim + pkt(lockLines...) + flush +
+		pkt("status 200", "next-cursor=next") + delim + pkt(append(lockLines, "owner 1 ours")...) + flush +
+		pkt(append([]string{"status 200"}, lockArgs...)...) + flush
+
+	require.Equal(t, expected, output)
+}
+
+func TestFailedRequests(t *testing.T) {
+	url, cleanup := setup(t, &bytes.Buffer{})
+	defer cleanup()
+
+	_, err := execute(t, url, "1", "push", "")
+	require.EqualError(t, err, "Disallowed command")
+
+	_, err = execute(t, url, "2", "download", "")
+	require.EqualError(t, err, "Access denied")
+}
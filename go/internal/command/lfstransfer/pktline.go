@@ -0,0 +1,184 @@
+package lfstransfer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	pktLenSize = 4
+	// maxPktDataSize is the largest payload git allows in a single pkt-line
+	maxPktDataSize = 65516
+)
+
+type pktType int
+
+const (
+	pktData pktType = iota
+	pktFlush
+	pktDelim
+)
+
+var (
+	flushPkt = []byte("0000")
+	delimPkt = []byte("0001")
+
+	errUnexpectedPkt = errors.New("unexpected pkt-line")
+	errLineTooLong   = errors.New("line too long for a pkt-line")
+)
+
+type pktReader struct {
+	r io.Reader
+}
+
+func (p *pktReader) readPkt() (pktType, []byte, error) {
+	lenBytes := make([]byte, pktLenSize)
+	if _, err := io.ReadFull(p.r, lenBytes); err != nil {
+		return pktData, nil, err
+	}
+
+	length, err := strconv.ParseUint(string(lenBytes), 16, 16)
+	if err != nil {
+		return pktData, nil, fmt.Errorf("invalid pkt-line length %q", lenBytes)
+	}
+
+	switch {
+	case length == 0:
+		return pktFlush, nil, nil
+	case length == 1:
+		return pktDelim, nil, nil
+	case length < pktLenSize:
+		return pktData, nil, fmt.Errorf("invalid pkt-line length %q", lenBytes)
+	}
+
+	data := make([]byte, length-pktLenSize)
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return pktData, nil, err
+	}
+
+	return pktData, data, nil
+}
+
+// readLines reads text pkt-lines until a flush or delim packet, which is
+// returned along with the lines stripped from their trailing newline.
+func (p *pktReader) readLines() ([]string, pktType, error) {
+	var lines []string
+
+	for {
+		kind, data, err := p.readPkt()
+		if err != nil {
+			return nil, kind, err
+		}
+
+		if kind != pktData {
+			return lines, kind, nil
+		}
+
+		lines = append(lines, string(bytes.TrimSuffix(data, []byte("\n"))))
+	}
+}
+
+// dataReader returns a reader for the binary data packets that follow,
+// up to the terminating flush packet.
+func (p *pktReader) dataReader() io.Reader {
+	return &pktDataReader{pkts: p}
+}
+
+type pktDataReader struct {
+	pkts *pktReader
+	buf  []byte
+	done bool
+}
+
+func (d *pktDataReader) Read(b []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		kind, data, err := d.pkts.readPkt()
+		if err != nil {
+			return 0, err
+		}
+
+		switch kind {
+		case pktFlush:
+			d.done = true
+		case pktDelim:
+			return 0, errUnexpectedPkt
+		default:
+			d.buf = data
+		}
+	}
+
+	n := copy(b, d.buf)
+	d.buf = d.buf[n:]
+
+	return n, nil
+}
+
+type pktWriter struct {
+	w io.Writer
+}
+
+func (p *pktWriter) writeData(data []byte) error {
+	for len(data) > 0 {
+		size := len(data)
+		if size > maxPktDataSize {
+			size = maxPktDataSize
+		}
+
+		if _, err := fmt.Fprintf(p.w, "%04x", size+pktLenSize); err != nil {
+			return err
+		}
+
+		if _, err := p.w.Write(data[:size]); err != nil {
+			return err
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+// writeLine sends line as a single packet, as text lines cannot be split
+func (p *pktWriter) writeLine(line string) error {
+	if len(line)+1 > maxPktDataSize {
+		return errLineTooLong
+	}
+
+	return p.writeData([]byte(line + "\n"))
+}
+
+func (p *pktWriter) writeLines(lines ...string) error {
+	for _, line := range lines {
+		if err := p.writeLine(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *pktWriter) writeFlush() error {
+	_, err := p.w.Write(flushPkt)
+	return err
+}
+
+func (p *pktWriter) writeDelim() error {
+	_, err := p.w.Write(delimPkt)
+	return err
+}
+
+// Write implements io.Writer by splitting b into data packets.
+func (p *pktWriter) Write(b []byte) (int, error) {
+	if err := p.writeData(b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
@@ -0,0 +1,60 @@
+package lfstransfer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLines(t *testing.T) {
+	reader := &pktReader{r: strings.NewReader("000abatch\n0011refname=main\n0001000aoid 1\n0000")}
+
+	lines, kind, err := reader.readLines()
+	require.NoError(t, err)
+	require.Equal(t, []string{"batch", "refname=main"}, lines)
+	require.Equal(t, pktDelim, kind)
+
+	lines, kind, err = reader.readLines()
+	require.NoError(t, err)
+	require.Equal(t, []string{"oid 1"}, lines)
+	require.Equal(t, pktFlush, kind)
+}
+
+func TestInvalidLength(t *testing.T) {
+	reader := &pktReader{r: strings.NewReader("zzzzdata")}
+
+	_, _, err := reader.readLines()
+	require.EqualError(t, err, `invalid pkt-line length "zzzz"`)
+}
+
+func TestDataRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), maxPktDataSize+10)
+
+	buf := &bytes.Buffer{}
+	writer := &pktWriter{w: buf}
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.writeFlush())
+
+	require.Equal(t, "fff0", buf.String()[:4])
+
+	reader := &pktReader{r: buf}
+	result, err := ioutil.ReadAll(reader.dataReader())
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+}
+
+func TestWriteLongLine(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := &pktWriter{w: buf}
+
+	require.NoError(t, writer.writeLine(strings.Repeat("x", maxPktDataSize-1)))
+	require.Equal(t, "fff0", buf.String()[:4])
+
+	buf.Reset()
+	require.Equal(t, errLineTooLong, writer.writeLine(strings.Repeat("x", maxPktDataSize)))
+	require.Empty(t, buf.String())
+}
@@ -0,0 +1,506 @@
+package lfstransfer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/lfstransfer"
+)
+
+const (
+	protocolVersion = "1"
+	hashAlgo        = "sha256"
+	basicTransfer   = "basic"
+
+	noopAction     = "noop"
+	verifyAction   = "verify"
+	uploadAction   = "upload"
+	downloadAction = "download"
+)
+
+type session struct {
+	operation string
+	client    *lfstransfer.Client
+	reader    *pktReader
+	writer    *pktWriter
+	// objects remembers the actions returned by batch requests, so that
+	// the following object transfers know where to go
+	objects map[string]*lfstransfer.BatchObject
+}
+
+type request struct {
+	command string
+	arg     string
+	args    map[string]string
+	// hasData is set when the arguments were terminated by a delim packet,
+	// meaning that data packets follow up to the next flush packet
+	hasData bool
+}
+
+type status struct {
+	code  int
+	args  []string
+	lines []string
+}
+
+func (s *session) serve() error {
+	if err := s.advertise(); err != nil {
+		return err
+	}
+
+	for {
+		lines, kind, err := s.reader.readLines()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(lines) == 0 {
+			return errUnexpectedPkt
+		}
+
+		req := newRequest(lines, kind == pktDelim)
+
+		if req.command == "quit" {
+			return s.writeStatus(&status{code: http.StatusOK})
+		}
+
+		response, err := s.handle(req)
+		if err != nil {
+			apiErr, ok := err.(*lfstransfer.ApiError)
+			if !ok {
+				return err
+			}
+
+			response = errorStatus(apiErr.StatusCode, apiErr.Message)
+		}
+
+		if err := s.writeStatus(response); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *session) advertise() error {
+	if err := s.writer.writeLines("version="+protocolVersion, "locking"); err != nil {
+		return err
+	}
+
+	return s.writer.writeFlush()
+}
+
+func (s *session) handle(req *request) (*status, error) {
+	switch req.command {
+	case "version":
+		return s.version(req)
+	case "batch":
+		return s.batch(req)
+	case "put-object":
+		return s.putObject(req)
+	case "verify-object":
+		return s.verifyObject(req)
+	case "get-object":
+		return s.getObject(req)
+	case "lock":
+		return s.lock(req)
+	case "list-lock":
+		return s.listLock(req)
+	case "unlock":
+		return s.unlock(req)
+	}
+
+	if err := s.skipData(req); err != nil {
+		return nil, err
+	}
+
+	return errorStatus(http.StatusBadRequest, "unknown command"), nil
+}
+
+func (s *session) version(req *request) (*status, error) {
+	if req.arg != protocolVersion {
+		return errorStatus(http.StatusBadRequest, "unknown version"), nil
+	}
+
+	return &status{code: http.StatusOK}, nil
+}
+
+func (s *session) batch(req *request) (*status, error) {
+	var lines []string
+	if req.hasData {
+		var err error
+		if lines, _, err = s.reader.readLines(); err != nil {
+			return nil, err
+		}
+	}
+
+	if algo, ok := req.args["hash-algo"]; ok && algo != hashAlgo {
+		return errorStatus(http.StatusConflict, "unsupported hash algorithm"), nil
+	}
+
+	if transfer, ok := req.args["transfer"]; ok && transfer != basicTransfer {
+		return errorStatus(http.StatusConflict, "unsupported transfer"), nil
+	}
+
+	var objects []*lfstransfer.BatchObject
+	for _, line := range lines {
+		object, err := parseObject(line)
+		if err != nil {
+			return errorStatus(http.StatusBadRequest, err.Error()), nil
+		}
+
+		objects = append(objects, object)
+	}
+
+	response, err := s.client.Batch(s.operation, objects, req.args["refname"])
+	if err != nil {
+		return nil, err
+	}
+
+	var results []string
+	for _, object := range response.Objects {
+		s.objects[object.Oid] = object
+
+		action := noopAction
+		if object.Actions[s.operation] != nil {
+			action = s.operation
+		}
+
+		results = append(results, fmt.Sprintf("%s %d %s", object.Oid, object.Size, action))
+	}
+
+	return &status{code: http.StatusOK, args: []string{"transfer=" + basicTransfer, "hash-algo=" + hashAlgo}, lines: results}, nil
+}
+
+func (s *session) putObject(req *request) (*status, error) {
+	if s.operation != uploadAction {
+		if err := s.skipData(req); err != nil {
+			return nil, err
+		}
+
+		return errorStatus(http.StatusForbidden, "not an upload session"), nil
+	}
+
+	size, err := strconv.ParseInt(req.args["size"], 10, 64)
+	if err != nil || !req.hasData {
+		if err := s.skipData(req); err != nil {
+			return nil, err
+		}
+
+		return errorStatus(http.StatusBadRequest, "invalid size"), nil
+	}
+
+	data := s.reader.dataReader()
+	// Whatever happens, the data has to be consumed for the session to go on
+	defer io.Copy(ioutil.Discard, data)
+
+	action, err := s.objectAction(req.arg, size, uploadAction)
+	if err != nil {
+		return nil, err
+	}
+
+	// The object is already known to GitLab
+	if action == nil {
+		return &status{code: http.StatusOK}, nil
+	}
+
+	if err := s.client.Upload(action, size, data); err != nil {
+		return nil, err
+	}
+
+	return &status{code: http.StatusOK}, nil
+}
+
+func (s *session) verifyObject(req *request) (*status, error) {
+	if err := s.skipData(req); err != nil {
+		return nil, err
+	}
+
+	size, err := strconv.ParseInt(req.args["size"], 10, 64)
+	if err != nil {
+		return errorStatus(http.StatusBadRequest, "invalid size"), nil
+	}
+
+	object := s.objects[req.arg]
+	if object == nil || object.Actions[verifyAction] == nil {
+		return &status{code: http.StatusOK}, nil
+	}
+
+	if err := s.client.Verify(object.Actions[verifyAction], req.arg, size); err != nil {
+		return nil, err
+	}
+
+	return &status{code: http.StatusOK}, nil
+}
+
+func (s *session) getObject(req *request) (*status, error) {
+	if err := s.skipData(req); err != nil {
+		return nil, err
+	}
+
+	var size int64
+	if object := s.objects[req.arg]; object != nil {
+		size = object.Size
+	}
+
+	action, err := s.objectAction(req.arg, size, downloadAction)
+	if err != nil {
+		return nil, err
+	}
+
+	if action == nil {
+		return errorStatus(http.StatusNotFound, "object not found"), nil
+	}
+
+	body, contentLength, err := s.client.Download(action)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if contentLength >= 0 {
+		size = contentLength
+	}
+
+	if err := s.writer.writeLines("status 200", fmt.Sprintf("size=%d", size)); err != nil {
+		return nil, err
+	}
+
+	if err := s.writer.writeDelim(); err != nil {
+		return nil, err
+	}
+
+	// Once the status was sent, errors can only end the session
+	if _, err := io.Copy(s.writer, body); err != nil {
+		return nil, fmt.Errorf("failed to send object: %v", err)
+	}
+
+	return nil, s.writer.writeFlush()
+}
+
+func (s *session) lock(req *request) (*status, error) {
+	if err := s.skipData(req); err != nil {
+		return nil, err
+	}
+
+	path, ok := req.args["path"]
+	if !ok {
+		return errorStatus(http.StatusBadRequest, "missing path"), nil
+	}
+
+	lock, err := s.client.Lock(path, req.args["refname"])
+	if apiErr, ok := err.(*lfstransfer.ApiError); ok && apiErr.StatusCode == http.StatusConflict && lock != nil {
+		return &status{code: http.StatusConflict, args: lockArgs(lock), lines: []string{apiErr.Message}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &status{code: http.StatusCreated, args: lockArgs(lock)}, nil
+}
+
+func (s *session) listLock(req *request) (*status, error) {
+	if err := s.skipData(req); err != nil {
+		return nil, err
+	}
+
+	limit, _ := strconv.Atoi(req.args["limit"])
+
+	// Listing locks for a ref is done by git-lfs before pushing, it
+	// needs to know which locks belong to the pusher
+	if refname := req.args["refname"]; refname != "" && s.operation == uploadAction {
+		locks, err := s.client.VerifyLocks(refname, req.args["cursor"], limit)
+		if err != nil {
+			return nil, err
+		}
+
+		var lines []string
+		for _, lock := range locks.Ours {
+			lines = append(lines, lockLines(lock, "ours")...)
+		}
+		for _, lock := range locks.Theirs {
+			lines = append(lines, lockLines(lock, "theirs")...)
+		}
+
+		return &status{code: http.StatusOK, args: nextCursorArgs(locks.NextCursor), lines: lines}, nil
+	}
+
+	params := url.Values{}
+	for _, name := range []string{"path", "id", "cursor", "limit"} {
+		if value, ok := req.args[name]; ok {
+			params.Set(name, value)
+		}
+	}
+	if refname, ok := req.args["refname"]; ok {
+		params.Set("refspec", refname)
+	}
+
+	locks, err := s.client.ListLocks(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, lock := range locks.Locks {
+		lines = append(lines, lockLines(lock, "")...)
+	}
+
+	return &status{code: http.StatusOK, args: nextCursorArgs(locks.NextCursor), lines: lines}, nil
+}
+
+func (s *session) unlock(req *request) (*status, error) {
+	if err := s.skipData(req); err != nil {
+		return nil, err
+	}
+
+	lock, err := s.client.Unlock(req.arg, req.args["force"] == "true", req.args["refname"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &status{code: http.StatusOK, args: lockArgs(lock)}, nil
+}
+
+// objectAction returns the action to use for oid, asking the LFS API when the
+// object was not part of a previous batch request. A nil action means there
+// is nothing to transfer.
+func (s *session) objectAction(oid string, size int64, name string) (*lfstransfer.Action, error) {
+	object := s.objects[oid]
+
+	if object == nil {
+		response, err := s.client.Batch(s.operation, []*lfstransfer.BatchObject{{Oid: oid, Size: size}}, "")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range response.Objects {
+			s.objects[o.Oid] = o
+		}
+
+		object = s.objects[oid]
+	}
+
+	if object == nil {
+		return nil, nil
+	}
+
+	return object.Actions[name], nil
+}
+
+func (s *session) skipData(req *request) error {
+	if !req.hasData {
+		return nil
+	}
+
+	_, err := io.Copy(ioutil.Discard, s.reader.dataReader())
+
+	return err
+}
+
+// writeStatus sends the response to a command. A nil status means the
+// handler already sent its response.
+func (s *session) writeStatus(st *status) error {
+	if st == nil {
+		return nil
+	}
+
+	if err := s.writer.writeLine(fmt.Sprintf("status %d", st.code)); err != nil {
+		return err
+	}
+
+	if err := s.writer.writeLines(st.args...); err != nil {
+		return err
+	}
+
+	if st.lines != nil {
+		if err := s.writer.writeDelim(); err != nil {
+			return err
+		}
+
+		if err := s.writer.writeLines(st.lines...); err != nil {
+			return err
+		}
+	}
+
+	return s.writer.writeFlush()
+}
+
+func newRequest(lines []string, hasData bool) *request {
+	req := &request{args: make(map[string]string), hasData: hasData}
+
+	parts := strings.SplitN(lines[0], " ", 2)
+	req.command = parts[0]
+	if len(parts) == 2 {
+		req.arg = parts[1]
+	}
+
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			req.args[parts[0]] = parts[1]
+		} else {
+			req.args[parts[0]] = ""
+		}
+	}
+
+	return req
+}
+
+func parseObject(line string) (*lfstransfer.BatchObject, error) {
+	parts := strings.Split(line, " ")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid object %q", line)
+	}
+
+	size, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object %q", line)
+	}
+
+	return &lfstransfer.BatchObject{Oid: parts[0], Size: size}, nil
+}
+
+func errorStatus(code int, message string) *status {
+	return &status{code: code, lines: []string{message}}
+}
+
+func lockArgs(lock *lfstransfer.Lock) []string {
+	args := []string{"id=" + lock.Id, "path=" + lock.Path, "locked-at=" + lock.LockedAt}
+	if lock.Owner != nil {
+		args = append(args, "ownername="+lock.Owner.Name)
+	}
+
+	return args
+}
+
+func lockLines(lock *lfstransfer.Lock, owner string) []string {
+	lines := []string{
+		"lock " + lock.Id,
+		"path " + lock.Id + " " + lock.Path,
+		"locked-at " + lock.Id + " " + lock.LockedAt,
+	}
+
+	if lock.Owner != nil {
+		lines = append(lines, "ownername "+lock.Id+" "+lock.Owner.Name)
+	}
+
+	if owner != "" {
+		lines = append(lines, "owner "+lock.Id+" "+owner)
+	}
+
+	return lines
+}
+
+func nextCursorArgs(cursor string) []string {
+	if cursor == "" {
+		return nil
+	}
+
+	return []string{"next-cursor=" + cursor}
+}
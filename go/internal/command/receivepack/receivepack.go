@@ -0,0 +1,75 @@
+package receivepack
+
+import (
+	"context"
+	"os"
+
+	pb "gitlab.com/gitlab-org/gitaly-proto/go/gitalypb"
+	"google.golang.org/grpc"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/customaction"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/disallowedcommand"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/handler"
+)
+
+type Command struct {
+	Config *config.Config
+	Args   *commandargs.CommandArgs
+}
+
+func (c *Command) Execute(readWriter *readwriter.ReadWriter) error {
+	args := c.Args.SshArgs
+	if len(args) != 2 {
+		return disallowedcommand.Error
+	}
+
+	repo := args[1]
+	response, err := c.verifyAccess(readWriter, repo)
+	if err != nil {
+		return err
+	}
+
+	if response.IsCustomAction() {
+		// When the response from /api/v4/allowed is a HTTP 300, a custom
+		// action has to be performed instead of calling Gitaly
+		customAction := customaction.Command{Config: c.Config, Response: response, ReadWriter: readWriter}
+		return customAction.Execute()
+	}
+
+	return c.performGitalyCall(response)
+}
+
+func (c *Command) verifyAccess(readWriter *readwriter.ReadWriter, repo string) (*accessverifier.Response, error) {
+	cmd := accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: readWriter}
+
+	return cmd.Verify(commandargs.ReceivePack, repo)
+}
+
+func (c *Command) performGitalyCall(response *accessverifier.Response) error {
+	gc := &handler.GitalyCommand{
+		Config:      c.Config,
+		ServiceName: string(commandargs.ReceivePack),
+		Address:     response.Gitaly.Address,
+		Token:       response.Gitaly.Token,
+		Repo:        response.Repo,
+		Who:         response.Who,
+		Username:    response.Username,
+	}
+
+	request := &pb.SSHReceivePackRequest{
+		Repository:       &response.Gitaly.Repo,
+		GlId:             response.Who,
+		GlRepository:     response.Repo,
+		GlUsername:       response.Username,
+		GitProtocol:      os.Getenv("GIT_PROTOCOL"),
+		GitConfigOptions: response.GitConfigOptions,
+	}
+
+	return gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
+		return handler.ReceivePack(ctx, conn, request)
+	})
+}
@@ -0,0 +1,110 @@
+package receivepack
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				var requestBody map[string]interface{}
+				json.Unmarshal(b, &requestBody)
+
+				if requestBody["action"] != "git-receive-pack" || requestBody["project"] != "group/repo" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if requestBody["key_id"] == "2" {
+					w.WriteHeader(http.StatusMultipleChoices)
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"status": true,
+						"payload": map[string]interface{}{
+							"action": "geo_proxy_to_primary",
+							"data": map[string]interface{}{
+								"api_endpoints": []string{"/api/v4/geo/proxy_git_push_ssh/push"},
+								"info_message":  "Proxying to primary",
+							},
+						},
+					})
+					return
+				}
+
+				body := map[string]interface{}{
+					"status":              false,
+					"message":             "Access denied",
+					"gl_console_messages": []string{"console", "message"},
+				}
+				json.NewEncoder(w).Encode(body)
+			},
+		},
+		{
+			Path: "/api/v4/geo/proxy_git_push_ssh/push",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]interface{}{"result": []byte("pushed")})
+			},
+		},
+	}
+)
+
+func TestForbiddenAccess(t *testing.T) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	cmd := &Command{
+		Config: &config.Config{GitlabUrl: url},
+		Args:   &commandargs.CommandArgs{GitlabKeyId: "1", SshArgs: []string{"git-receive-pack", "group/repo"}},
+	}
+	output := &bytes.Buffer{}
+
+	err = cmd.Execute(&readwriter.ReadWriter{Out: output, ErrOut: output})
+
+	assert.EqualError(t, err, "Access denied")
+	assert.Equal(t, "> GitLab: console\n> GitLab: message\n", output.String())
+}
+
+func TestCustomAction(t *testing.T) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	cmd := &Command{
+		Config: &config.Config{GitlabUrl: url},
+		Args:   &commandargs.CommandArgs{GitlabKeyId: "2", SshArgs: []string{"git-receive-pack", "group/repo"}},
+	}
+	output := &bytes.Buffer{}
+	errOutput := &bytes.Buffer{}
+
+	err = cmd.Execute(&readwriter.ReadWriter{Out: output, ErrOut: errOutput, In: &bytes.Buffer{}})
+
+	require.NoError(t, err)
+	assert.Equal(t, "pushed", output.String())
+	assert.Equal(t, "> GitLab: Proxying to primary\n", errOutput.String())
+}
+
+func TestDisallowedCommand(t *testing.T) {
+	cmd := &Command{
+		Config: &config.Config{},
+		Args:   &commandargs.CommandArgs{GitlabKeyId: "1", SshArgs: []string{"git-receive-pack"}},
+	}
+
+	err := cmd.Execute(&readwriter.ReadWriter{})
+
+	assert.EqualError(t, err, "Disallowed command")
+}
@@ -0,0 +1,43 @@
+package accessverifier
+
+import (
+	"errors"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+type Response = accessverifier.Response
+
+type Command struct {
+	Config     *config.Config
+	Args       *commandargs.CommandArgs
+	ReadWriter *readwriter.ReadWriter
+}
+
+// Verify asks the internal API whether the user may run action against
+// repo, and turns a denial into an error carrying the server's message.
+func (c *Command) Verify(action commandargs.CommandType, repo string) (*Response, error) {
+	client, err := accessverifier.NewClient(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Verify(c.Args, action, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	console.DisplayMessages(response.ConsoleMessages, c.ReadWriter.ErrOut)
+
+	if !response.Success {
+		logger.Warn("Access denied", map[string]interface{}{"command": c.Args.SshCommand, "message": response.Message})
+		return nil, errors.New(response.Message)
+	}
+
+	return response, nil
+}
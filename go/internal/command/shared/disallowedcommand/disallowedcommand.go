@@ -0,0 +1,7 @@
+package disallowedcommand
+
+import "errors"
+
+var (
+	Error = errors.New("Disallowed command")
+)
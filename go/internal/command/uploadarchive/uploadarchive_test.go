@@ -0,0 +1,69 @@
+package uploadarchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, _ := ioutil.ReadAll(r.Body)
+				var requestBody map[string]interface{}
+				json.Unmarshal(b, &requestBody)
+
+				if requestBody["action"] != "git-upload-archive" || requestBody["project"] != "group/repo" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				body := map[string]interface{}{
+					"status":  false,
+					"message": "Access denied",
+				}
+				json.NewEncoder(w).Encode(body)
+			},
+		},
+	}
+)
+
+func TestForbiddenAccess(t *testing.T) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	cmd := &Command{
+		Config: &config.Config{GitlabUrl: url},
+		Args:   &commandargs.CommandArgs{GitlabKeyId: "1", SshArgs: []string{"git-upload-archive", "group/repo"}},
+	}
+	output := &bytes.Buffer{}
+
+	err = cmd.Execute(&readwriter.ReadWriter{Out: output, ErrOut: output})
+
+	assert.EqualError(t, err, "Access denied")
+	assert.Empty(t, output.String())
+}
+
+func TestDisallowedCommand(t *testing.T) {
+	cmd := &Command{
+		Config: &config.Config{},
+		Args:   &commandargs.CommandArgs{GitlabKeyId: "1", SshArgs: []string{"git-upload-archive"}},
+	}
+
+	err := cmd.Execute(&readwriter.ReadWriter{})
+
+	assert.EqualError(t, err, "Disallowed command")
+}
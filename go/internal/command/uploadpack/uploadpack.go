@@ -0,0 +1,66 @@
+package uploadpack
+
+import (
+	"context"
+	"os"
+
+	pb "gitlab.com/gitlab-org/gitaly-proto/go/gitalypb"
+	"google.golang.org/grpc"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/readwriter"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/accessverifier"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/shared/disallowedcommand"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/handler"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/throttle"
+)
+
+type Command struct {
+	Config *config.Config
+	Args   *commandargs.CommandArgs
+}
+
+func (c *Command) Execute(readWriter *readwriter.ReadWriter) error {
+	args := c.Args.SshArgs
+	if len(args) != 2 {
+		return disallowedcommand.Error
+	}
+
+	repo := args[1]
+	response, err := c.verifyAccess(readWriter, repo)
+	if err != nil {
+		return err
+	}
+
+	return c.performGitalyCall(response)
+}
+
+func (c *Command) verifyAccess(readWriter *readwriter.ReadWriter, repo string) (*accessverifier.Response, error) {
+	cmd := accessverifier.Command{Config: c.Config, Args: c.Args, ReadWriter: readWriter}
+
+	return cmd.Verify(commandargs.UploadPack, repo)
+}
+
+func (c *Command) performGitalyCall(response *accessverifier.Response) error {
+	gc := &handler.GitalyCommand{
+		Config:         c.Config,
+		ServiceName:    string(commandargs.UploadPack),
+		Address:        response.Gitaly.Address,
+		Token:          response.Gitaly.Token,
+		BandwidthLimit: throttle.NewLimit(&c.Config.BandwidthLimit, response.BandwidthLimit),
+		Repo:           response.Repo,
+		Who:            response.Who,
+		Username:       response.Username,
+	}
+
+	request := &pb.SSHUploadPackRequest{
+		Repository:       &response.Gitaly.Repo,
+		GitProtocol:      os.Getenv("GIT_PROTOCOL"),
+		GitConfigOptions: response.GitConfigOptions,
+	}
+
+	return gc.RunGitalyCommand(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
+		return handler.UploadPack(ctx, conn, request)
+	})
+}
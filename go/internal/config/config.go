@@ -14,6 +14,15 @@ const (
 	configFile            = "config.yml"
 	logFile               = "gitlab-shell.log"
 	defaultSecretFileName = ".gitlab_shell_secret"
+
+	defaultDisabledCommandMessage = "This command is disabled on this server"
+	defaultMaintenanceFlagFile    = "maintenance"
+	defaultRateLimitDir           = "tmp/rate_limit"
+	defaultAdmissionDir           = "tmp/admission"
+
+	defaultAuthorizedKeysCacheDir         = "tmp/authorized_keys_cache"
+	defaultAuthorizedKeysCacheTtl         = 60
+	defaultAuthorizedKeysCacheNegativeTtl = 10
 )
 
 type MigrationConfig struct {
@@ -30,6 +39,107 @@ type HttpSettingsConfig struct {
 	SelfSignedCert     bool   `yaml:"self_signed_cert"`
 }
 
+// AuthorizedKeysCacheConfig configures the on-disk cache of /authorized_keys
+// lookups done by gitlab-shell-authorized-keys-check. Unknown keys are cached
+// for NegativeTtlSeconds so that bursts of them don't each reach the API.
+type AuthorizedKeysCacheConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	Dir                string `yaml:"dir"`
+	TtlSeconds         uint64 `yaml:"ttl"`
+	NegativeTtlSeconds uint64 `yaml:"negative_ttl"`
+}
+
+// AuthorizedKeysIndexConfig configures the index of authorized_keys that
+// gitlab-keys maintains. gitlab-shell-authorized-keys-check answers from it
+// while it matches auth_file, and only asks the API about keys it doesn't
+// contain.
+type AuthorizedKeysIndexConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+// AuthorizedPrincipalsConfig configures gitlab-shell-authorized-principals-check.
+// With Validate set, only the principals that the API maps to an active user
+// are authorized.
+type AuthorizedPrincipalsConfig struct {
+	Validate bool `yaml:"validate"`
+}
+
+// CommandsConfig restricts the SSH commands users may run, whether they are
+// implemented in Go or in Ruby. All commands are enabled when Enabled is empty.
+type CommandsConfig struct {
+	Enabled         []string `yaml:"enabled"`
+	DisabledMessage string   `yaml:"disabled_message"`
+}
+
+// MaintenanceConfig stops pushes, with Mode read_only, or every new command,
+// with Mode drain. Creating FlagFile with either mode as its content switches
+// modes as well, an empty one drains.
+type MaintenanceConfig struct {
+	Mode     string `yaml:"mode"`
+	FlagFile string `yaml:"flag_file"`
+	// Message is shown along with the refusal, such as a link to a status page
+	Message string `yaml:"message"`
+}
+
+// RateLimitConfig limits the Git sessions of every key or user across all the
+// gitlab-shell processes of the host, keeping their state in Dir. A limit of 0
+// is no limit. Sessions over a limit wait up to WaitSeconds for their turn.
+type RateLimitConfig struct {
+	Dir           string `yaml:"dir"`
+	MaxConcurrent int    `yaml:"max_concurrent"`
+	MaxPerMinute  int    `yaml:"max_per_minute"`
+	WaitSeconds   uint64 `yaml:"wait"`
+}
+
+// AdmissionConfig caps the Git sessions of the whole host at MaxConcurrent.
+// Up to MaxQueued more sessions wait for WaitSeconds at most, in order. New
+// sessions are shed while the load average or the count of Gitaly streams in
+// flight is over its threshold. Zero values disable each setting.
+type AdmissionConfig struct {
+	Dir              string  `yaml:"dir"`
+	MaxConcurrent    int     `yaml:"max_concurrent"`
+	MaxQueued        int     `yaml:"max_queued"`
+	WaitSeconds      uint64  `yaml:"wait"`
+	MaxLoadAverage   float64 `yaml:"max_load_average"`
+	MaxGitalyStreams int     `yaml:"max_gitaly_streams"`
+}
+
+// BandwidthLimitConfig throttles what upload-pack and upload-archive exchange
+// with SSH clients, in each direction. GitLab may override BytesPerSecond for
+// a user or deploy key in its /allowed response. 0 is no limit.
+type BandwidthLimitConfig struct {
+	BytesPerSecond int64 `yaml:"bytes_per_second"`
+	// BurstBytes defaults to a second worth of bandwidth
+	BurstBytes int64 `yaml:"burst_bytes"`
+}
+
+// IpRulesConfig lists CIDR ranges, or single addresses, that clients may or
+// may not connect from. Deny wins over allow, and a non-empty allow list
+// rejects anything it doesn't match.
+type IpRulesConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// SshAccessConfig restricts where SSH clients may connect from, before the
+// API is asked. The rules for a command type, such as git-receive-pack, apply
+// on top of the global ones.
+type SshAccessConfig struct {
+	IpRulesConfig `yaml:",inline"`
+	Commands      map[string]IpRulesConfig `yaml:"commands"`
+}
+
+type GitlabKeysConfig struct {
+	// CompactThreshold is the share of removed lines in authorized_keys above
+	// which rm-key compacts the file. Zero disables automatic compaction.
+	CompactThreshold float64 `yaml:"compact_threshold"`
+	// AllowedKeyTypes restricts the types of keys written to
+	// authorized_keys. Any OpenSSH key type is allowed when it is empty.
+	AllowedKeyTypes []string `yaml:"allowed_key_types"`
+	MinRsaBits      int      `yaml:"min_rsa_bits"`
+}
+
 type Config struct {
 	RootDir        string
 	LogFile        string             `yaml:"log_file"`
@@ -41,6 +151,18 @@ type Config struct {
 	Secret         string             `yaml:"secret"`
 	HttpSettings   HttpSettingsConfig `yaml:"http_settings"`
 	HttpClient     *HttpClient
+	AuthFile       string `yaml:"auth_file"`
+
+	AuthorizedKeysCache  AuthorizedKeysCacheConfig  `yaml:"authorized_keys_cache"`
+	AuthorizedKeysIndex  AuthorizedKeysIndexConfig  `yaml:"authorized_keys_index"`
+	AuthorizedPrincipals AuthorizedPrincipalsConfig `yaml:"authorized_principals"`
+	GitlabKeys           GitlabKeysConfig           `yaml:"gitlab_keys"`
+	SshAccess            SshAccessConfig            `yaml:"ssh_access"`
+	Commands             CommandsConfig             `yaml:"commands"`
+	Maintenance          MaintenanceConfig          `yaml:"maintenance"`
+	RateLimit            RateLimitConfig            `yaml:"rate_limit"`
+	Admission            AdmissionConfig            `yaml:"admission"`
+	BandwidthLimit       BandwidthLimitConfig       `yaml:"bandwidth_limit"`
 }
 
 func New() (*Config, error) {
@@ -70,6 +192,21 @@ func (c *Config) FeatureEnabled(featureName string) bool {
 	return false
 }
 
+// CommandEnabled tells whether users may run commands of commandType
+func (c *Config) CommandEnabled(commandType string) bool {
+	if len(c.Commands.Enabled) == 0 {
+		return true
+	}
+
+	for _, enabledCommand := range c.Commands.Enabled {
+		if enabledCommand == commandType {
+			return true
+		}
+	}
+
+	return false
+}
+
 func newFromFile(filename string) (*Config, error) {
 	cfg := &Config{RootDir: path.Dir(filename)}
 
@@ -112,6 +249,44 @@ func parseConfig(configBytes []byte, cfg *Config) error {
 		cfg.GitlabUrl = unescapedUrl
 	}
 
+	if cfg.AuthFile == "" {
+		cfg.AuthFile = path.Join(os.Getenv("HOME"), ".ssh/authorized_keys")
+	}
+
+	parseAuthorizedKeysCache(cfg)
+
+	if cfg.Commands.DisabledMessage == "" {
+		cfg.Commands.DisabledMessage = defaultDisabledCommandMessage
+	}
+
+	if cfg.Maintenance.FlagFile == "" {
+		cfg.Maintenance.FlagFile = defaultMaintenanceFlagFile
+	}
+
+	if !filepath.IsAbs(cfg.Maintenance.FlagFile) {
+		cfg.Maintenance.FlagFile = path.Join(cfg.RootDir, cfg.Maintenance.FlagFile)
+	}
+
+	if cfg.RateLimit.Dir == "" {
+		cfg.RateLimit.Dir = defaultRateLimitDir
+	}
+
+	if !filepath.IsAbs(cfg.RateLimit.Dir) {
+		cfg.RateLimit.Dir = path.Join(cfg.RootDir, cfg.RateLimit.Dir)
+	}
+
+	if cfg.Admission.Dir == "" {
+		cfg.Admission.Dir = defaultAdmissionDir
+	}
+
+	if !filepath.IsAbs(cfg.Admission.Dir) {
+		cfg.Admission.Dir = path.Join(cfg.RootDir, cfg.Admission.Dir)
+	}
+
+	if cfg.AuthorizedKeysIndex.Path == "" {
+		cfg.AuthorizedKeysIndex.Path = cfg.AuthFile + ".index"
+	}
+
 	if err := parseSecret(cfg); err != nil {
 		return err
 	}
@@ -119,6 +294,26 @@ func parseConfig(configBytes []byte, cfg *Config) error {
 	return nil
 }
 
+func parseAuthorizedKeysCache(cfg *Config) {
+	cache := &cfg.AuthorizedKeysCache
+
+	if cache.Dir == "" {
+		cache.Dir = defaultAuthorizedKeysCacheDir
+	}
+
+	if !filepath.IsAbs(cache.Dir) {
+		cache.Dir = path.Join(cfg.RootDir, cache.Dir)
+	}
+
+	if cache.TtlSeconds == 0 {
+		cache.TtlSeconds = defaultAuthorizedKeysCacheTtl
+	}
+
+	if cache.NegativeTtlSeconds == 0 {
+		cache.NegativeTtlSeconds = defaultAuthorizedKeysCacheNegativeTtl
+	}
+}
+
 func parseSecret(cfg *Config) error {
 	// The secret was parsed from yaml no need to read another file
 	if cfg.Secret != "" {
@@ -121,6 +121,107 @@ func TestParseConfig(t *testing.T) {
 	}
 }
 
+func TestParseAuthorizedKeysCache(t *testing.T) {
+	testCases := []struct {
+		yaml     string
+		expected AuthorizedKeysCacheConfig
+	}{
+		{
+			expected: AuthorizedKeysCacheConfig{Dir: path.Join(testRoot, "tmp/authorized_keys_cache"), TtlSeconds: 60, NegativeTtlSeconds: 10},
+		},
+		{
+			yaml:     "authorized_keys_cache:\n  enabled: true\n  dir: /run/gitlab-shell/cache\n  ttl: 300\n  negative_ttl: 30",
+			expected: AuthorizedKeysCacheConfig{Enabled: true, Dir: "/run/gitlab-shell/cache", TtlSeconds: 300, NegativeTtlSeconds: 30},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("yaml input: %q", tc.yaml), func(t *testing.T) {
+			cfg := Config{RootDir: testRoot, Secret: "secret"}
+
+			require.NoError(t, parseConfig([]byte(tc.yaml), &cfg))
+			require.Equal(t, tc.expected, cfg.AuthorizedKeysCache)
+		})
+	}
+}
+
+func TestParseAuthFile(t *testing.T) {
+	restoreEnv := testhelper.TempEnv(map[string]string{"HOME": "/home/git"})
+	defer restoreEnv()
+
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte(""), &cfg))
+	require.Equal(t, "/home/git/.ssh/authorized_keys", cfg.AuthFile)
+
+	require.Equal(t, "/home/git/.ssh/authorized_keys.index", cfg.AuthorizedKeysIndex.Path)
+
+	cfg = Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte("auth_file: /var/opt/gitlab/.ssh/authorized_keys"), &cfg))
+	require.Equal(t, "/var/opt/gitlab/.ssh/authorized_keys", cfg.AuthFile)
+	require.Equal(t, "/var/opt/gitlab/.ssh/authorized_keys.index", cfg.AuthorizedKeysIndex.Path)
+
+	cfg = Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte("authorized_keys_index:\n  enabled: true\n  path: /run/gitlab/keys.index"), &cfg))
+	require.Equal(t, AuthorizedKeysIndexConfig{Enabled: true, Path: "/run/gitlab/keys.index"}, cfg.AuthorizedKeysIndex)
+}
+
+func TestParseSshAccess(t *testing.T) {
+	yaml := `
+ssh_access:
+  allow: [10.0.0.0/8, 192.168.0.0/16]
+  deny: [10.1.0.0/16]
+  commands:
+    git-receive-pack:
+      allow: [10.8.0.0/16]
+`
+
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte(yaml), &cfg))
+
+	expected := SshAccessConfig{
+		IpRulesConfig: IpRulesConfig{Allow: []string{"10.0.0.0/8", "192.168.0.0/16"}, Deny: []string{"10.1.0.0/16"}},
+		Commands:      map[string]IpRulesConfig{"git-receive-pack": {Allow: []string{"10.8.0.0/16"}}},
+	}
+	require.Equal(t, expected, cfg.SshAccess)
+}
+
+func TestCommandEnabled(t *testing.T) {
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte(""), &cfg))
+
+	require.True(t, cfg.CommandEnabled("git-upload-archive"))
+	require.Equal(t, "This command is disabled on this server", cfg.Commands.DisabledMessage)
+
+	cfg = Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte("commands:\n  enabled: [discover, git-upload-pack]\n  disabled_message: Nope"), &cfg))
+
+	require.True(t, cfg.CommandEnabled("git-upload-pack"))
+	require.False(t, cfg.CommandEnabled("git-upload-archive"))
+	require.Equal(t, "Nope", cfg.Commands.DisabledMessage)
+}
+
+func TestParseMaintenance(t *testing.T) {
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte(""), &cfg))
+	require.Equal(t, MaintenanceConfig{FlagFile: path.Join(testRoot, "maintenance")}, cfg.Maintenance)
+
+	cfg = Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte("maintenance:\n  mode: read_only\n  flag_file: /run/gitlab-shell/maintenance\n  message: See status.example.com"), &cfg))
+	require.Equal(t, MaintenanceConfig{Mode: "read_only", FlagFile: "/run/gitlab-shell/maintenance", Message: "See status.example.com"}, cfg.Maintenance)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte("rate_limit:\n  max_concurrent: 2\n  max_per_minute: 10\n  wait: 5"), &cfg))
+	require.Equal(t, RateLimitConfig{Dir: path.Join(testRoot, "tmp/rate_limit"), MaxConcurrent: 2, MaxPerMinute: 10, WaitSeconds: 5}, cfg.RateLimit)
+}
+
+func TestParseAdmission(t *testing.T) {
+	cfg := Config{RootDir: testRoot, Secret: "secret"}
+	require.NoError(t, parseConfig([]byte("admission:\n  dir: /run/admission\n  max_concurrent: 50\n  max_queued: 100\n  wait: 30\n  max_load_average: 16.5\n  max_gitaly_streams: 80"), &cfg))
+	require.Equal(t, AdmissionConfig{Dir: "/run/admission", MaxConcurrent: 50, MaxQueued: 100, WaitSeconds: 30, MaxLoadAverage: 16.5, MaxGitalyStreams: 80}, cfg.Admission)
+}
+
 func TestFeatureEnabled(t *testing.T) {
 	testCases := []struct {
 		desc          string
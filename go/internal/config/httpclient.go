@@ -18,6 +18,7 @@ const (
 	httpProtocol              = "http://"
 	httpsProtocol             = "https://"
 	defaultReadTimeoutSeconds = 300
+	connectTimeout            = 30 * time.Second
 )
 
 type HttpClient struct {
@@ -66,7 +67,32 @@ func (c *Config) buildSocketTransport() (*http.Transport, string) {
 	return transport, socketBaseUrl
 }
 
+// GetExternalHttpClient returns a client for the URLs GitLab hands out,
+// such as the LFS API of a repository. They are reached over HTTP(S) even
+// when gitlab_url is a socket, trusting the same certificates as the
+// internal API client. Only connecting and waiting for a response are bound
+// by timeouts, as bodies may be as large as LFS objects.
+func (c *Config) GetExternalHttpClient() *http.Client {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: connectTimeout}).DialContext,
+		TLSClientConfig:       c.buildTlsConfig(),
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: c.readTimeout(),
+	}
+
+	return &http.Client{Transport: transport}
+}
+
 func (c *Config) buildHttpsTransport() (*http.Transport, string) {
+	transport := &http.Transport{
+		TLSClientConfig: c.buildTlsConfig(),
+	}
+
+	return transport, c.GitlabUrl
+}
+
+func (c *Config) buildTlsConfig() *tls.Config {
 	certPool, err := x509.SystemCertPool()
 
 	if err != nil {
@@ -90,14 +116,10 @@ func (c *Config) buildHttpsTransport() (*http.Transport, string) {
 		}
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			RootCAs:            certPool,
-			InsecureSkipVerify: c.HttpSettings.SelfSignedCert,
-		},
+	return &tls.Config{
+		RootCAs:            certPool,
+		InsecureSkipVerify: c.HttpSettings.SelfSignedCert,
 	}
-
-	return transport, c.GitlabUrl
 }
 
 func addCertToPool(certPool *x509.CertPool, fileName string) {
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
@@ -20,3 +21,17 @@ func TestReadTimeout(t *testing.T) {
 	require.NotNil(t, client)
 	assert.Equal(t, time.Duration(expectedSeconds)*time.Second, client.HttpClient.Timeout)
 }
+
+func TestExternalHttpClient(t *testing.T) {
+	config := &Config{
+		GitlabUrl:    "http+unix:///var/run/gitlab.socket",
+		HttpSettings: HttpSettingsConfig{ReadTimeoutSeconds: 30, SelfSignedCert: true},
+	}
+	client := config.GetExternalHttpClient()
+
+	transport, ok := client.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 30*time.Second, transport.ResponseHeaderTimeout)
+	assert.Equal(t, connectTimeout, transport.TLSHandshakeTimeout)
+	assert.True(t, transport.TLSClientConfig.InsecureSkipVerify)
+}
@@ -0,0 +1,63 @@
+package console
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	LinePreface = "> GitLab:"
+)
+
+// UserError is implemented by errors whose message is meant for the user,
+// which DisplayError shows prefaced like the messages from GitLab.
+type UserError interface {
+	error
+	UserMessage() string
+}
+
+// Error is a UserError with nothing more to it than its message
+type Error struct {
+	Message string
+}
+
+func NewError(message string) *Error {
+	return &Error{Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) UserMessage() string {
+	return e.Message
+}
+
+// DisplayMessages writes each non-empty message on its own line, prefaced
+// the same way the Ruby implementation does.
+func DisplayMessages(messages []string, out io.Writer) {
+	for _, message := range messages {
+		if message == "" {
+			continue
+		}
+
+		fmt.Fprintf(out, "%s %s\n", LinePreface, message)
+	}
+}
+
+// DisplayMessage splits a multi-line message and displays each line.
+func DisplayMessage(message string, out io.Writer) {
+	DisplayMessages(strings.Split(message, "\n"), out)
+}
+
+// DisplayError displays the message of a UserError, and any other error as
+// is.
+func DisplayError(err error, out io.Writer) {
+	if userErr, ok := err.(UserError); ok {
+		DisplayMessage(userErr.UserMessage(), out)
+		return
+	}
+
+	fmt.Fprintf(out, "%v\n", err)
+}
@@ -0,0 +1,34 @@
+package console
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisplayMessages(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	DisplayMessages([]string{"first", "", "second"}, out)
+
+	assert.Equal(t, "> GitLab: first\n> GitLab: second\n", out.String())
+}
+
+func TestDisplayMessage(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	DisplayMessage("first\nsecond", out)
+
+	assert.Equal(t, "> GitLab: first\n> GitLab: second\n", out.String())
+}
+
+func TestDisplayError(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	DisplayError(NewError("Access denied"), out)
+	DisplayError(errors.New("Internal API error"), out)
+
+	assert.Equal(t, "> GitLab: Access denied\nInternal API error\n", out.String())
+}
@@ -0,0 +1,19 @@
+package executable
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// RootDir determines the root directory (and so, the location of the config
+// file) from os.Executable()
+func RootDir() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	// Start: /opt/.../gitlab-shell/bin/gitlab-shell
+	// Ends:  /opt/.../gitlab-shell
+	return filepath.Dir(filepath.Dir(path)), nil
+}
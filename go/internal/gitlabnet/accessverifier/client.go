@@ -0,0 +1,150 @@
+package accessverifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	pb "gitlab.com/gitlab-org/gitaly-proto/go/gitalypb"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+)
+
+const (
+	protocol   = "ssh"
+	anyChanges = "_any"
+
+	apiInaccessibleMessage = "API is not accessible"
+)
+
+type Client struct {
+	client *gitlabnet.GitlabClient
+}
+
+type Request struct {
+	Action   commandargs.CommandType `json:"action"`
+	Repo     string                  `json:"project"`
+	Changes  string                  `json:"changes"`
+	Protocol string                  `json:"protocol"`
+	KeyId    string                  `json:"key_id,omitempty"`
+	UserId   string                  `json:"user_id,omitempty"`
+	Username string                  `json:"username,omitempty"`
+	CheckIp  string                  `json:"check_ip,omitempty"`
+	// Certificate is the SSH certificate the user authenticated with
+	Certificate *commandargs.Certificate `json:"certificate,omitempty"`
+}
+
+type Gitaly struct {
+	Repo    pb.Repository `json:"repository"`
+	Address string        `json:"address"`
+	Token   string        `json:"token"`
+}
+
+type CustomPayloadData struct {
+	ApiEndpoints []string `json:"api_endpoints"`
+	Username     string   `json:"gl_username"`
+	PrimaryRepo  string   `json:"primary_repo"`
+	InfoMessage  string   `json:"info_message"`
+	UserId       string   `json:"gl_id,omitempty"`
+	Streaming    bool     `json:"streaming,omitempty"`
+}
+
+type CustomPayload struct {
+	Action string             `json:"action"`
+	Data   *CustomPayloadData `json:"data"`
+}
+
+type Response struct {
+	Success          bool          `json:"status"`
+	Message          string        `json:"message"`
+	Repo             string        `json:"gl_repository"`
+	ProjectPath      string        `json:"gl_project_path"`
+	UserId           string        `json:"gl_id"`
+	Username         string        `json:"gl_username"`
+	GitConfigOptions []string      `json:"git_config_options"`
+	GitProtocol      string        `json:"git_protocol"`
+	Gitaly           Gitaly        `json:"gitaly"`
+	Payload          CustomPayload `json:"payload"`
+	ConsoleMessages  []string      `json:"gl_console_messages"`
+	BandwidthLimit   *int64        `json:"bandwidth_limit"`
+	Who              string        `json:"-"`
+	StatusCode       int           `json:"-"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{client: client}, nil
+}
+
+func (c *Client) Verify(args *commandargs.CommandArgs, action commandargs.CommandType, repo string) (*Response, error) {
+	request := &Request{Action: action, Repo: repo, Protocol: protocol, Changes: anyChanges, CheckIp: args.SshConnection.RemoteIp, Certificate: args.Certificate}
+
+	if args.GitlabUsername != "" {
+		request.Username = args.GitlabUsername
+	} else if args.GitlabUserId != "" {
+		request.UserId = args.GitlabUserId
+	} else {
+		request.KeyId = args.GitlabKeyId
+	}
+
+	response, err := c.client.PostAccepting("/allowed", request, http.StatusMultipleChoices)
+	if err != nil {
+		return deniedResponse(err)
+	}
+	defer response.Body.Close()
+
+	return parse(response, args)
+}
+
+// deniedResponse turns the JSON error bodies GitLab sends along with a 401,
+// 404 or 503 into a denial carrying the server's message, like the Ruby
+// implementation does. Any other error is returned as is.
+func deniedResponse(err error) (*Response, error) {
+	apiErr, ok := err.(*gitlabnet.ApiError)
+	if !ok {
+		return nil, err
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusNotFound, http.StatusServiceUnavailable:
+		message := apiInaccessibleMessage
+		if apiErr.HasMessage {
+			message = apiErr.Message
+		}
+
+		return &Response{Success: false, Message: message, StatusCode: apiErr.StatusCode}, nil
+	}
+
+	return nil, err
+}
+
+func parse(hr *http.Response, args *commandargs.CommandArgs) (*Response, error) {
+	response := &Response{}
+	if err := json.NewDecoder(hr.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("Parsing failed")
+	}
+
+	response.StatusCode = hr.StatusCode
+
+	if args.GitlabKeyId != "" {
+		response.Who = "key-" + args.GitlabKeyId
+	} else if args.GitlabUserId != "" {
+		response.Who = "user-" + args.GitlabUserId
+	} else {
+		response.Who = response.UserId
+	}
+
+	return response, nil
+}
+
+// IsCustomAction tells whether GitLab answered with HTTP 300 and expects
+// the payload to be processed instead of calling Gitaly.
+func (r *Response) IsCustomAction() bool {
+	return r.StatusCode == http.StatusMultipleChoices
+}
@@ -0,0 +1,290 @@
+package accessverifier
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	pb "gitlab.com/gitlab-org/gitaly-proto/go/gitalypb"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	repo        = "group/private"
+	action      = commandargs.ReceivePack
+	certificate = &commandargs.Certificate{KeyId: "alice@example.com", Principals: []string{"alice"}, Serial: 42, CaFingerprint: "SHA256:ca"}
+)
+
+func buildExpectedResponse(who string) *Response {
+	bandwidthLimit := int64(1048576)
+
+	return &Response{
+		Success:          true,
+		Message:          "",
+		Repo:             "project-26",
+		ProjectPath:      "group/private",
+		UserId:           "user-1",
+		Username:         "root",
+		GitConfigOptions: []string{"option"},
+		Gitaly: Gitaly{
+			Repo: pb.Repository{
+				StorageName:                   "default",
+				RelativePath:                  "@hashed/5f/9c/5f9c4ab08cac7457e9111a30e4664920607ea2c115a1433d7be98e97e64244ca.git",
+				GitObjectDirectory:            "path/to/git_object_directory",
+				GitAlternateObjectDirectories: []string{"path/to/git_alternate_object_directory"},
+				GlRepository:                  "project-26",
+				GlProjectPath:                 repo,
+			},
+			Address: "unix:gitaly.socket",
+			Token:   "token",
+		},
+		ConsoleMessages: []string{"console", "message"},
+		BandwidthLimit:  &bandwidthLimit,
+		Who:             who,
+		StatusCode:      200,
+	}
+}
+
+func TestSuccessfulResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc string
+		args *commandargs.CommandArgs
+		who  string
+	}{
+		{
+			desc: "Provide key id within the request",
+			args: &commandargs.CommandArgs{GitlabKeyId: "1"},
+			who:  "key-1",
+		}, {
+			desc: "Provide user id within the request",
+			args: &commandargs.CommandArgs{GitlabUserId: "1"},
+			who:  "user-1",
+		}, {
+			desc: "Provide username within the request",
+			args: &commandargs.CommandArgs{GitlabUsername: "first"},
+			who:  "user-1",
+		}, {
+			desc: "Provide the certificate within the request",
+			args: &commandargs.CommandArgs{GitlabKeyId: "5", Certificate: certificate},
+			who:  "key-5",
+		}, {
+			desc: "Provide the client IP within the request",
+			args: &commandargs.CommandArgs{GitlabKeyId: "6", SshConnection: commandargs.SshConnection{RemoteIp: "192.168.1.10"}},
+			who:  "key-6",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result, err := client.Verify(tc.args, action, repo)
+			require.NoError(t, err)
+
+			response := buildExpectedResponse(tc.who)
+			require.Equal(t, response, result)
+			require.False(t, result.IsCustomAction())
+		})
+	}
+}
+
+func TestGeoPushGetCustomAction(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	args := &commandargs.CommandArgs{GitlabUsername: "custom"}
+	result, err := client.Verify(args, action, repo)
+	require.NoError(t, err)
+
+	require.True(t, result.IsCustomAction())
+	require.Equal(t, "geo_proxy_to_primary", result.Payload.Action)
+	require.Equal(t, []string{"/api/v4/geo/proxy_git_push_ssh/info_refs", "/api/v4/geo/proxy_git_push_ssh/push"}, result.Payload.Data.ApiEndpoints)
+	require.Equal(t, "Message from the primary", result.Payload.Data.InfoMessage)
+}
+
+func TestDeniedResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc            string
+		keyId           string
+		expectedMessage string
+		expectedStatus  int
+	}{
+		{
+			desc:            "A 401 response with a JSON message",
+			keyId:           "401",
+			expectedMessage: "Not authorized!",
+			expectedStatus:  http.StatusUnauthorized,
+		}, {
+			desc:            "A 404 response with a JSON message",
+			keyId:           "404",
+			expectedMessage: "The project you were looking for could not be found.",
+			expectedStatus:  http.StatusNotFound,
+		}, {
+			desc:            "A 503 response without a JSON body",
+			keyId:           "503",
+			expectedMessage: "API is not accessible",
+			expectedStatus:  http.StatusServiceUnavailable,
+		}, {
+			desc:            "A successful response that denies access",
+			keyId:           "2",
+			expectedMessage: "You are not allowed to push code to this project.",
+			expectedStatus:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			args := &commandargs.CommandArgs{GitlabKeyId: tc.keyId}
+			result, err := client.Verify(args, action, repo)
+			require.NoError(t, err)
+
+			require.False(t, result.Success)
+			require.Equal(t, tc.expectedMessage, result.Message)
+			require.Equal(t, tc.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		expectedError string
+	}{
+		{
+			desc:          "A 403 response with a JSON message",
+			keyId:         "403",
+			expectedError: "Forbidden!",
+		}, {
+			desc:          "A 500 response without a JSON body",
+			keyId:         "500",
+			expectedError: "Internal API error (500)",
+		}, {
+			desc:          "A response with bad JSON",
+			keyId:         "3",
+			expectedError: "Parsing failed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			args := &commandargs.CommandArgs{GitlabKeyId: tc.keyId}
+			result, err := client.Verify(args, action, repo)
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Nil(t, result)
+		})
+	}
+}
+
+func setup(t *testing.T) (*Client, func()) {
+	allowedBody := map[string]interface{}{
+		"status":             true,
+		"gl_repository":      "project-26",
+		"gl_project_path":    "group/private",
+		"gl_id":              "user-1",
+		"gl_username":        "root",
+		"git_config_options": []string{"option"},
+		"gitaly": map[string]interface{}{
+			"repository": map[string]interface{}{
+				"storage_name":                     "default",
+				"relative_path":                    "@hashed/5f/9c/5f9c4ab08cac7457e9111a30e4664920607ea2c115a1433d7be98e97e64244ca.git",
+				"git_object_directory":             "path/to/git_object_directory",
+				"git_alternate_object_directories": []string{"path/to/git_alternate_object_directory"},
+				"gl_repository":                    "project-26",
+				"gl_project_path":                  "group/private",
+			},
+			"address": "unix:gitaly.socket",
+			"token":   "token",
+		},
+		"gl_console_messages": []string{"console", "message"},
+		"bandwidth_limit":     1048576,
+	}
+
+	customActionBody := map[string]interface{}{
+		"status":        true,
+		"gl_repository": "project-26",
+		"gl_id":         "user-1",
+		"gl_username":   "custom",
+		"payload": map[string]interface{}{
+			"action": "geo_proxy_to_primary",
+			"data": map[string]interface{}{
+				"api_endpoints": []string{"/api/v4/geo/proxy_git_push_ssh/info_refs", "/api/v4/geo/proxy_git_push_ssh/push"},
+				"gl_username":   "custom",
+				"primary_repo":  "https://repo/path",
+				"info_message":  "Message from the primary",
+			},
+		},
+	}
+
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/allowed",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				var requestBody *Request
+				require.NoError(t, json.Unmarshal(b, &requestBody))
+				require.Equal(t, "ssh", requestBody.Protocol)
+				require.Equal(t, "_any", requestBody.Changes)
+				require.Equal(t, repo, requestBody.Repo)
+				require.Equal(t, action, requestBody.Action)
+
+				switch {
+				case requestBody.Username == "first", requestBody.UserId == "1", requestBody.KeyId == "1":
+					json.NewEncoder(w).Encode(allowedBody)
+				case requestBody.Username == "custom":
+					w.WriteHeader(http.StatusMultipleChoices)
+					json.NewEncoder(w).Encode(customActionBody)
+				case requestBody.KeyId == "6" && requestBody.CheckIp == "192.168.1.10":
+					json.NewEncoder(w).Encode(allowedBody)
+				case requestBody.KeyId == "5" && requestBody.Certificate != nil:
+					require.Equal(t, certificate, requestBody.Certificate)
+					json.NewEncoder(w).Encode(allowedBody)
+				case requestBody.KeyId == "2":
+					json.NewEncoder(w).Encode(map[string]interface{}{
+						"status":  false,
+						"message": "You are not allowed to push code to this project.",
+					})
+				case requestBody.KeyId == "3":
+					w.Write([]byte("{ \"message\": \"broken json!\""))
+				case requestBody.KeyId == "401":
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(map[string]string{"message": "Not authorized!"})
+				case requestBody.KeyId == "403":
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(map[string]string{"message": "Forbidden!"})
+				case requestBody.KeyId == "404":
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(map[string]string{"message": "The project you were looking for could not be found."})
+				case requestBody.KeyId == "500":
+					w.WriteHeader(http.StatusInternalServerError)
+				case requestBody.KeyId == "503":
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
@@ -0,0 +1,150 @@
+package authorizedkeys
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/keyline"
+)
+
+const (
+	AuthorizedKeysPath = "/authorized_keys"
+)
+
+type Client struct {
+	config *config.Config
+	client *gitlabnet.GitlabClient
+}
+
+type Response struct {
+	Id  int64  `json:"id"`
+	Key string `json:"key"`
+	// The restrictions below are optional and enforced by sshd
+	From      []string `json:"from,omitempty"`
+	ExpiresAt string   `json:"expires_at,omitempty"`
+	Restrict  bool     `json:"restrict,omitempty"`
+}
+
+type KeysPage struct {
+	Keys   []*Response `json:"keys"`
+	Cursor string      `json:"cursor"`
+	// More tells whether List should be called again after the last key
+	More bool `json:"more"`
+}
+
+type ChangesPage struct {
+	Added   []*Response `json:"added"`
+	Removed []int64     `json:"removed"`
+	Cursor  string      `json:"cursor"`
+	// More tells whether Changes should be called again with Cursor
+	More bool `json:"more"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+// KeyLine builds the authorized_keys line of the key, including its
+// restrictions.
+func (r *Response) KeyLine(rootDir string) (*keyline.KeyLine, error) {
+	keyLine, err := keyline.NewPublicKeyLine(strconv.FormatInt(r.Id, 10), r.Key, rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &keyline.Options{From: r.From, Restrict: r.Restrict}
+
+	if r.ExpiresAt != "" {
+		expiryTime, err := time.Parse(time.RFC3339, r.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid expires_at: %s", r.ExpiresAt)
+		}
+		options.ExpiryTime = expiryTime
+	}
+
+	if err := keyLine.SetOptions(options); err != nil {
+		return nil, err
+	}
+
+	return keyLine, nil
+}
+
+func (c *Client) GetByKey(key string) (*Response, error) {
+	params := url.Values{}
+	params.Add("key", key)
+
+	parsedResponse := &Response{}
+	if err := c.getJSON(AuthorizedKeysPath+"?"+params.Encode(), parsedResponse); err != nil {
+		return nil, err
+	}
+
+	return parsedResponse, nil
+}
+
+// GetByFingerprint looks a key up by its SHA256 fingerprint, which keeps the
+// key itself out of the URL.
+func (c *Client) GetByFingerprint(keyType, fingerprint string) (*Response, error) {
+	params := url.Values{}
+	params.Add("key_type", keyType)
+	params.Add("fingerprint", fingerprint)
+
+	parsedResponse := &Response{}
+	if err := c.getJSON(AuthorizedKeysPath+"?"+params.Encode(), parsedResponse); err != nil {
+		return nil, err
+	}
+
+	return parsedResponse, nil
+}
+
+// List returns up to perPage keys with an id greater than afterId, ordered
+// by id, along with a cursor for Changes reflecting the state at the time of
+// the call. Paging by id doesn't skip keys when others are removed meanwhile.
+func (c *Client) List(afterId int64, perPage int) (*KeysPage, error) {
+	params := url.Values{}
+	params.Add("after_id", strconv.FormatInt(afterId, 10))
+	params.Add("per_page", strconv.Itoa(perPage))
+
+	parsedResponse := &KeysPage{}
+	if err := c.getJSON(AuthorizedKeysPath+"/list?"+params.Encode(), parsedResponse); err != nil {
+		return nil, err
+	}
+
+	return parsedResponse, nil
+}
+
+// Changes returns keys that were added and removed since cursor
+func (c *Client) Changes(cursor string) (*ChangesPage, error) {
+	params := url.Values{}
+	params.Add("cursor", cursor)
+
+	parsedResponse := &ChangesPage{}
+	if err := c.getJSON(AuthorizedKeysPath+"/changes?"+params.Encode(), parsedResponse); err != nil {
+		return nil, err
+	}
+
+	return parsedResponse, nil
+}
+
+func (c *Client) getJSON(path string, result interface{}) error {
+	response, err := c.client.Get(path)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("Parsing failed")
+	}
+
+	return nil
+}
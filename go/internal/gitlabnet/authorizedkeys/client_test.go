@@ -0,0 +1,204 @@
+package authorizedkeys
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	requests []testserver.TestRequestHandler
+)
+
+func init() {
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/authorized_keys",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("fingerprint") == "SHA256:fingerprint+with/special=chars" && r.URL.Query().Get("key_type") == "ssh-ed25519" {
+					json.NewEncoder(w).Encode(&Response{Id: 2, Key: "ssh-ed25519 AAAA"})
+					return
+				}
+
+				switch r.URL.Query().Get("key") {
+				case "key+with/special=chars":
+					json.NewEncoder(w).Encode(&Response{Id: 1, Key: "key+with/special=chars"})
+				case "broken-message":
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(&gitlabnet.ErrorResponse{Message: "Not allowed!"})
+				case "broken":
+					w.Write([]byte("{ \"key\": \"broken json!\""))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			},
+		},
+		{
+			Path: "/api/v4/internal/authorized_keys/list",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("after_id") != "1" || r.URL.Query().Get("per_page") != "1" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				json.NewEncoder(w).Encode(&KeysPage{Keys: []*Response{{Id: 2, Key: "ssh-rsa BBBB"}}, Cursor: "100", More: true})
+			},
+		},
+		{
+			Path: "/api/v4/internal/authorized_keys/changes",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("cursor") != "100" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				json.NewEncoder(w).Encode(&ChangesPage{Added: []*Response{{Id: 3, Key: "ssh-rsa CCCC"}}, Removed: []int64{1}, Cursor: "101"})
+			},
+		},
+	}
+}
+
+func TestGetByKey(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	result, err := client.GetByKey("key+with/special=chars")
+	require.NoError(t, err)
+	require.Equal(t, &Response{Id: 1, Key: "key+with/special=chars"}, result)
+}
+
+func TestGetByFingerprint(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	result, err := client.GetByFingerprint("ssh-ed25519", "SHA256:fingerprint+with/special=chars")
+	require.NoError(t, err)
+	require.Equal(t, &Response{Id: 2, Key: "ssh-ed25519 AAAA"}, result)
+
+	_, err = client.GetByFingerprint("ssh-rsa", "SHA256:fingerprint+with/special=chars")
+	require.EqualError(t, err, "Internal API error (404)")
+}
+
+func TestGetByKeyErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		key           string
+		expectedError string
+		statusCode    int
+	}{
+		{
+			desc:          "A response with an error message",
+			key:           "broken-message",
+			expectedError: "Not allowed!",
+			statusCode:    http.StatusForbidden,
+		},
+		{
+			desc:          "A response with bad JSON",
+			key:           "broken",
+			expectedError: "Parsing failed",
+		},
+		{
+			desc:          "A response for an unknown key",
+			key:           "not-found",
+			expectedError: "Internal API error (404)",
+			statusCode:    http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			resp, err := client.GetByKey(tc.key)
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Nil(t, resp)
+
+			if apiError, ok := err.(*gitlabnet.ApiError); ok {
+				require.Equal(t, tc.statusCode, apiError.StatusCode)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	result, err := client.List(1, 1)
+	require.NoError(t, err)
+	require.Equal(t, &KeysPage{Keys: []*Response{{Id: 2, Key: "ssh-rsa BBBB"}}, Cursor: "100", More: true}, result)
+
+	_, err = client.List(2, 1)
+	require.EqualError(t, err, "Internal API error (400)")
+}
+
+func TestChanges(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	result, err := client.Changes("100")
+	require.NoError(t, err)
+	require.Equal(t, &ChangesPage{Added: []*Response{{Id: 3, Key: "ssh-rsa CCCC"}}, Removed: []int64{1}, Cursor: "101"}, result)
+}
+
+func TestResponseKeyLine(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		response      *Response
+		expectedLine  string
+		expectedError string
+	}{
+		{
+			desc:         "Without restrictions",
+			response:     &Response{Id: 1, Key: "ssh-rsa AAAA"},
+			expectedLine: `command="/tmp/bin/gitlab-shell key-1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa AAAA`,
+		},
+		{
+			desc:         "With restrictions",
+			response:     &Response{Id: 1, Key: "ssh-rsa AAAA", From: []string{"192.168.0.0/16"}, ExpiresAt: "2030-01-02T03:04:05+01:00", Restrict: true},
+			expectedLine: `command="/tmp/bin/gitlab-shell key-1",restrict,no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty,from="192.168.0.0/16",expiry-time="20300102020405Z" ssh-rsa AAAA`,
+		},
+		{
+			desc:          "With an invalid expiry date",
+			response:      &Response{Id: 1, Key: "ssh-rsa AAAA", ExpiresAt: "tomorrow"},
+			expectedError: "Invalid expires_at: tomorrow",
+		},
+		{
+			desc:          "With an invalid source address",
+			response:      &Response{Id: 1, Key: "ssh-rsa AAAA", From: []string{`1.1.1.1" evil`}},
+			expectedError: `Invalid from pattern: "1.1.1.1\" evil"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			keyLine, err := tc.response.KeyLine("/tmp")
+
+			if tc.expectedError != "" {
+				require.EqualError(t, err, tc.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedLine, keyLine.ToString())
+		})
+	}
+}
+
+func setup(t *testing.T) (*Client, func()) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
@@ -0,0 +1,55 @@
+package authorizedprincipals
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+)
+
+const (
+	AuthorizedPrincipalsPath = "/authorized_principals"
+)
+
+type Client struct {
+	config *config.Config
+	client *gitlabnet.GitlabClient
+}
+
+type Request struct {
+	KeyId      string   `json:"key_id"`
+	Principals []string `json:"principals"`
+}
+
+// Response lists the principals of the request that map to an active,
+// unblocked user.
+type Response struct {
+	Principals []string `json:"principals"`
+}
+
+func NewClient(config *config.Config) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client}, nil
+}
+
+func (c *Client) Validate(keyId string, principals []string) (*Response, error) {
+	request := &Request{KeyId: keyId, Principals: principals}
+
+	response, err := c.client.Post(AuthorizedPrincipalsPath, request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	parsedResponse := &Response{}
+	if err := json.NewDecoder(response.Body).Decode(parsedResponse); err != nil {
+		return nil, fmt.Errorf("Parsing failed")
+	}
+
+	return parsedResponse, nil
+}
@@ -0,0 +1,89 @@
+package authorizedprincipals
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+var (
+	requests []testserver.TestRequestHandler
+)
+
+func init() {
+	requests = []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/authorized_principals",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				var request *Request
+				json.NewDecoder(r.Body).Decode(&request)
+
+				switch request.KeyId {
+				case "someuser":
+					json.NewEncoder(w).Encode(&Response{Principals: request.Principals[:1]})
+				case "broken-message":
+					w.WriteHeader(http.StatusForbidden)
+					json.NewEncoder(w).Encode(&gitlabnet.ErrorResponse{Message: "Not allowed!"})
+				default:
+					w.Write([]byte("{ \"principals\": \"broken json!\""))
+				}
+			},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	result, err := client.Validate("someuser", []string{"sshUsers", "admins"})
+	require.NoError(t, err)
+	require.Equal(t, &Response{Principals: []string{"sshUsers"}}, result)
+}
+
+func TestValidateErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	testCases := []struct {
+		desc          string
+		keyId         string
+		expectedError string
+	}{
+		{
+			desc:          "A response with an error message",
+			keyId:         "broken-message",
+			expectedError: "Not allowed!",
+		},
+		{
+			desc:          "A response with bad JSON",
+			keyId:         "broken",
+			expectedError: "Parsing failed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			resp, err := client.Validate(tc.keyId, []string{"sshUsers"})
+
+			require.EqualError(t, err, tc.expectedError)
+			require.Nil(t, resp)
+		})
+	}
+}
+
+func setup(t *testing.T) (*Client, func()) {
+	cleanup, url, err := testserver.StartSocketHttpServer(requests)
+	require.NoError(t, err)
+
+	client, err := NewClient(&config.Config{GitlabUrl: url})
+	require.NoError(t, err)
+
+	return client, cleanup
+}
@@ -6,14 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	pathpkg "path"
 	"strings"
 
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
 )
 
 const (
-	internalApiPath  = "/api/v4/internal"
+	apiPath          = "/api/v4"
+	internalApiPath  = apiPath + "/internal"
 	secretHeaderName = "Gitlab-Shared-Secret"
 )
 
@@ -21,6 +24,20 @@ type ErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// ApiError is returned when the internal API responds with a status outside
+// of the 2xx range. HasMessage tells whether Message was taken from a
+// JSON error body sent by GitLab, which is kept in Body.
+type ApiError struct {
+	StatusCode int
+	Message    string
+	HasMessage bool
+	Body       []byte
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
 type GitlabClient struct {
 	httpClient *http.Client
 	config     *config.Config
@@ -48,9 +65,17 @@ func normalizePath(path string) string {
 	return path
 }
 
-func newRequest(method, host, path string, data interface{}) (*http.Request, error) {
-	path = normalizePath(path)
+// checkApiPath makes sure path is a clean path under the API root, as the
+// endpoints GitLab hands out for custom actions are
+func checkApiPath(path string) error {
+	if !strings.HasPrefix(path, apiPath+"/") || pathpkg.Clean(path) != path {
+		return fmt.Errorf("Invalid API path %q", path)
+	}
+
+	return nil
+}
 
+func newRequest(method, host, path string, data interface{}) (*http.Request, error) {
 	var jsonReader io.Reader
 	if data != nil {
 		jsonData, err := json.Marshal(data)
@@ -69,35 +94,88 @@ func newRequest(method, host, path string, data interface{}) (*http.Request, err
 	return request, nil
 }
 
-func parseError(resp *http.Response) error {
+func parseError(resp *http.Response, acceptedStatuses []int) error {
 	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
 		return nil
 	}
+	for _, status := range acceptedStatuses {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
 	defer resp.Body.Close()
 	parsedResponse := &ErrorResponse{}
 
-	if err := json.NewDecoder(resp.Body).Decode(parsedResponse); err != nil {
-		return fmt.Errorf("Internal API error (%v)", resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		err = json.Unmarshal(body, parsedResponse)
+	}
+
+	if err != nil {
+		return &ApiError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("Internal API error (%v)", resp.StatusCode)}
 	} else {
-		return fmt.Errorf(parsedResponse.Message)
+		return &ApiError{StatusCode: resp.StatusCode, Message: parsedResponse.Message, HasMessage: true, Body: body}
 	}
 
 }
 
 func (c *GitlabClient) Get(path string) (*http.Response, error) {
-	return c.doRequest("GET", path, nil)
+	return c.doRequest("GET", normalizePath(path), nil, nil)
 }
 
 func (c *GitlabClient) Post(path string, data interface{}) (*http.Response, error) {
-	return c.doRequest("POST", path, data)
+	return c.doRequest("POST", normalizePath(path), data, nil)
 }
 
-func (c *GitlabClient) doRequest(method, path string, data interface{}) (*http.Response, error) {
+// PostAccepting is Post for endpoints that answer with meaningful statuses
+// outside of the 2xx range, such as the 300 of /allowed for custom actions.
+func (c *GitlabClient) PostAccepting(path string, data interface{}, acceptedStatuses ...int) (*http.Response, error) {
+	return c.doRequest("POST", normalizePath(path), data, acceptedStatuses)
+}
+
+// PostApi posts to path, which is a full path under the API root rather than
+// one of the internal API.
+func (c *GitlabClient) PostApi(path string, data interface{}) (*http.Response, error) {
+	if err := checkApiPath(path); err != nil {
+		return nil, err
+	}
+
+	return c.doRequest("POST", path, data, nil)
+}
+
+// PostStream posts body as is, with the given content type, to a full path
+// under the API root. Unlike PostApi, the request is not bound by the
+// configured read timeout, so that large bodies such as a pushed pack can be
+// streamed to GitLab.
+func (c *GitlabClient) PostStream(path, contentType string, body io.Reader) (*http.Response, error) {
+	if err := checkApiPath(path); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest("POST", c.host+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Add("Content-Type", contentType)
+
+	streamingClient := &http.Client{Transport: c.httpClient.Transport}
+
+	return c.do(streamingClient, request, nil)
+}
+
+func (c *GitlabClient) doRequest(method, path string, data interface{}, acceptedStatuses []int) (*http.Response, error) {
 	request, err := newRequest(method, c.host, path, data)
 	if err != nil {
 		return nil, err
 	}
 
+	request.Header.Add("Content-Type", "application/json")
+
+	return c.do(c.httpClient, request, acceptedStatuses)
+}
+
+func (c *GitlabClient) do(httpClient *http.Client, request *http.Request, acceptedStatuses []int) (*http.Response, error) {
 	user, password := c.config.HttpSettings.User, c.config.HttpSettings.Password
 	if user != "" && password != "" {
 		request.SetBasicAuth(user, password)
@@ -106,15 +184,14 @@ func (c *GitlabClient) doRequest(method, path string, data interface{}) (*http.R
 	encodedSecret := base64.StdEncoding.EncodeToString([]byte(c.config.Secret))
 	request.Header.Set(secretHeaderName, encodedSecret)
 
-	request.Header.Add("Content-Type", "application/json")
 	request.Close = true
 
-	response, err := c.httpClient.Do(request)
+	response, err := httpClient.Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("Internal API unreachable")
 	}
 
-	if err := parseError(response); err != nil {
+	if err := parseError(response, acceptedStatuses); err != nil {
 		return nil, err
 	}
 
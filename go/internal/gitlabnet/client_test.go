@@ -60,6 +60,12 @@ func TestClients(t *testing.T) {
 				json.NewEncoder(w).Encode(body)
 			},
 		},
+		{
+			Path: "/api/v4/internal/multiple_choices",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusMultipleChoices)
+			},
+		},
 		{
 			Path: "/api/v4/internal/broken",
 			Handler: func(w http.ResponseWriter, r *http.Request) {
@@ -110,6 +116,8 @@ func TestClients(t *testing.T) {
 			testMissing(t, client)
 			testErrorMessage(t, client)
 			testAuthenticationHeader(t, client)
+			testAcceptedStatuses(t, client)
+			testApiPaths(t, client)
 		})
 	}
 }
@@ -217,3 +225,43 @@ func testAuthenticationHeader(t *testing.T, client *GitlabClient) {
 		assert.Equal(t, "sssh, it's a secret", string(header))
 	})
 }
+
+func testAcceptedStatuses(t *testing.T, client *GitlabClient) {
+	t.Run("Multiple choices are an error by default", func(t *testing.T) {
+		response, err := client.Post("/multiple_choices", map[string]string{})
+		assert.EqualError(t, err, "Internal API error (300)")
+		assert.Nil(t, response)
+	})
+
+	t.Run("Multiple choices when accepted", func(t *testing.T) {
+		response, err := client.PostAccepting("/multiple_choices", map[string]string{}, http.StatusMultipleChoices)
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		assert.Equal(t, http.StatusMultipleChoices, response.StatusCode)
+	})
+}
+
+func testApiPaths(t *testing.T, client *GitlabClient) {
+	t.Run("Successful API post", func(t *testing.T) {
+		response, err := client.PostApi("/api/v4/internal/post_endpoint", map[string]string{"key": "value"})
+		require.NoError(t, err)
+		defer response.Body.Close()
+
+		responseBody, err := ioutil.ReadAll(response.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "Echo: {\"key\":\"value\"}", string(responseBody))
+	})
+
+	for _, path := range []string{"/hello", "/api/v4", "/api/v4x/hello", "/api/v4/../hello", "/api/v4//internal/hello"} {
+		t.Run("Invalid API path "+path, func(t *testing.T) {
+			response, err := client.PostApi(path, map[string]string{})
+			assert.EqualError(t, err, fmt.Sprintf("Invalid API path %q", path))
+			assert.Nil(t, response)
+
+			response, err = client.PostStream(path, "text/plain", nil)
+			assert.EqualError(t, err, fmt.Sprintf("Invalid API path %q", path))
+			assert.Nil(t, response)
+		})
+	}
+}
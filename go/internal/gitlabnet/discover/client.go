@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
@@ -32,15 +33,25 @@ func NewClient(config *config.Config) (*Client, error) {
 }
 
 func (c *Client) GetByCommandArgs(args *commandargs.CommandArgs) (*Response, error) {
+	params := url.Values{}
+
 	if args.GitlabKeyId != "" {
-		return c.GetByKeyId(args.GitlabKeyId)
+		params.Add("key_id", args.GitlabKeyId)
 	} else if args.GitlabUsername != "" {
-		return c.GetByUsername(args.GitlabUsername)
+		params.Add("username", args.GitlabUsername)
 	} else {
 		// There was no 'who' information, this  matches the ruby error
 		// message.
 		return nil, fmt.Errorf("who='' is invalid")
 	}
+
+	if args.SshConnection.RemoteIp != "" {
+		params.Add("check_ip", args.SshConnection.RemoteIp)
+	}
+
+	addCertificateParams(params, args.Certificate)
+
+	return c.getResponse(params)
 }
 
 func (c *Client) GetByKeyId(keyId string) (*Response, error) {
@@ -57,6 +68,21 @@ func (c *Client) GetByUsername(username string) (*Response, error) {
 	return c.getResponse(params)
 }
 
+// addCertificateParams adds the details of the certificate the user
+// authenticated with, the way Rails expects nested parameters.
+func addCertificateParams(params url.Values, cert *commandargs.Certificate) {
+	if cert == nil {
+		return
+	}
+
+	params.Add("certificate[key_id]", cert.KeyId)
+	params.Add("certificate[serial]", strconv.FormatUint(cert.Serial, 10))
+	params.Add("certificate[ca_fingerprint]", cert.CaFingerprint)
+	for _, principal := range cert.Principals {
+		params.Add("certificate[principals][]", principal)
+	}
+}
+
 func (c *Client) parseResponse(resp *http.Response) (*Response, error) {
 	parsedResponse := &Response{}
 
@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
@@ -23,7 +25,18 @@ func init() {
 		{
 			Path: "/api/v4/internal/discover",
 			Handler: func(w http.ResponseWriter, r *http.Request) {
-				if r.URL.Query().Get("key_id") == "1" {
+				if r.URL.Query().Get("certificate[key_id]") != "" {
+					query := r.URL.Query()
+					if query.Get("key_id") != "5" || query.Get("certificate[key_id]") != "alice@example.com" || query.Get("certificate[serial]") != "42" ||
+						query.Get("certificate[ca_fingerprint]") != "SHA256:ca" || strings.Join(query["certificate[principals][]"], ",") != "alice,deploy" {
+						w.WriteHeader(http.StatusBadRequest)
+						return
+					}
+
+					json.NewEncoder(w).Encode(&Response{UserId: 3, Username: "alice", Name: "Alice"})
+				} else if r.URL.Query().Get("key_id") == "6" && r.URL.Query().Get("check_ip") == "192.168.1.10" {
+					json.NewEncoder(w).Encode(&Response{UserId: 6, Username: "checked", Name: "Checked"})
+				} else if r.URL.Query().Get("key_id") == "1" {
 					body := &Response{
 						UserId:   2,
 						Username: "alex-doe",
@@ -64,6 +77,31 @@ func TestGetByKeyId(t *testing.T) {
 	assert.Equal(t, &Response{UserId: 2, Username: "alex-doe", Name: "Alex Doe"}, result)
 }
 
+func TestGetByCommandArgsWithCertificate(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	args := &commandargs.CommandArgs{
+		GitlabKeyId: "5",
+		Certificate: &commandargs.Certificate{KeyId: "alice@example.com", Principals: []string{"alice", "deploy"}, Serial: 42, CaFingerprint: "SHA256:ca"},
+	}
+
+	result, err := client.GetByCommandArgs(args)
+	assert.NoError(t, err)
+	assert.Equal(t, &Response{UserId: 3, Username: "alice", Name: "Alice"}, result)
+}
+
+func TestGetByCommandArgsWithCheckIp(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	args := &commandargs.CommandArgs{GitlabKeyId: "6", SshConnection: commandargs.SshConnection{RemoteIp: "192.168.1.10"}}
+
+	result, err := client.GetByCommandArgs(args)
+	assert.NoError(t, err)
+	assert.Equal(t, &Response{UserId: 6, Username: "checked", Name: "Checked"}, result)
+}
+
 func TestGetByUsername(t *testing.T) {
 	client, cleanup := setup(t)
 	defer cleanup()
@@ -0,0 +1,84 @@
+package lfsauthenticate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet"
+)
+
+type Client struct {
+	config *config.Config
+	client *gitlabnet.GitlabClient
+	args   *commandargs.CommandArgs
+}
+
+type Request struct {
+	Operation string `json:"operation"`
+	Repo      string `json:"project"`
+	KeyId     string `json:"key_id,omitempty"`
+	UserId    string `json:"user_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	CheckIp   string `json:"check_ip,omitempty"`
+}
+
+type Response struct {
+	Username  string `json:"username"`
+	LfsToken  string `json:"lfs_token"`
+	RepoPath  string `json:"repository_http_path"`
+	ExpiresIn int    `json:"expires_in"`
+}
+
+func NewClient(config *config.Config, args *commandargs.CommandArgs) (*Client, error) {
+	client, err := gitlabnet.GetClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating http client: %v", err)
+	}
+
+	return &Client{config: config, client: client, args: args}, nil
+}
+
+// Authenticate requests an LFS token for repo. userId is the gl_id returned
+// by the access check, it is used to identify users that logged in with a
+// username, for instance through an SSH certificate.
+func (c *Client) Authenticate(operation, repo, userId string) (*Response, error) {
+	request := &Request{Operation: operation, Repo: repo, CheckIp: c.args.SshConnection.RemoteIp}
+
+	if c.args.GitlabKeyId != "" {
+		request.KeyId = c.args.GitlabKeyId
+	} else if c.args.GitlabUserId != "" {
+		request.UserId = c.args.GitlabUserId
+	} else if strings.HasPrefix(userId, "user-") {
+		request.UserId = strings.TrimPrefix(userId, "user-")
+	} else {
+		request.Username = c.args.GitlabUsername
+	}
+
+	response, err := c.client.Post("/lfs_authenticate", request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return parse(response)
+}
+
+func parse(hr *http.Response) (*Response, error) {
+	response := &Response{}
+	if err := json.NewDecoder(hr.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("Parsing failed")
+	}
+
+	return response, nil
+}
+
+// Authorization returns the value of the Authorization header to use for
+// the LFS API of the repository.
+func (r *Response) Authorization() string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(r.Username+":"+r.LfsToken))
+}
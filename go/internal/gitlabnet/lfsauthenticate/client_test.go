@@ -0,0 +1,147 @@
+package lfsauthenticate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+const (
+	keyId     = "123"
+	repo      = "group/repo"
+	operation = "download"
+)
+
+func setup(t *testing.T) []testserver.TestRequestHandler {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/api/v4/internal/lfs_authenticate",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				b, err := ioutil.ReadAll(r.Body)
+				defer r.Body.Close()
+
+				require.NoError(t, err)
+
+				var request *Request
+				require.NoError(t, json.Unmarshal(b, &request))
+				require.Equal(t, repo, request.Repo)
+				require.Equal(t, operation, request.Operation)
+
+				switch {
+				case request.KeyId == keyId, request.UserId == "1", request.Username == "jane-doe", request.KeyId == "checked" && request.CheckIp == "192.168.1.10":
+					body := map[string]interface{}{
+						"username":             "john",
+						"lfs_token":            "sometoken",
+						"repository_http_path": "https://gitlab.com/repo/path",
+						"expires_in":           1800,
+					}
+					require.NoError(t, json.NewEncoder(w).Encode(body))
+				case request.KeyId == "forbidden":
+					w.WriteHeader(http.StatusForbidden)
+				case request.KeyId == "broken":
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			},
+		},
+	}
+
+	return requests
+}
+
+func TestFailedRequests(t *testing.T) {
+	requests := setup(t)
+	cleanup, url, err := testserver.StartHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	testCases := []struct {
+		desc           string
+		args           *commandargs.CommandArgs
+		expectedOutput string
+	}{
+		{
+			desc:           "With bad response",
+			args:           &commandargs.CommandArgs{GitlabKeyId: "-1"},
+			expectedOutput: "Parsing failed",
+		},
+		{
+			desc:           "With API returns an error",
+			args:           &commandargs.CommandArgs{GitlabKeyId: "forbidden"},
+			expectedOutput: "Internal API error (403)",
+		},
+		{
+			desc:           "With API fails",
+			args:           &commandargs.CommandArgs{GitlabKeyId: "broken"},
+			expectedOutput: "Internal API error (500)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			client, err := NewClient(&config.Config{GitlabUrl: url}, tc.args)
+			require.NoError(t, err)
+
+			_, err = client.Authenticate(operation, repo, "")
+			require.Error(t, err)
+
+			require.Equal(t, tc.expectedOutput, err.Error())
+		})
+	}
+}
+
+func TestSuccessfulRequests(t *testing.T) {
+	requests := setup(t)
+	cleanup, url, err := testserver.StartHttpServer(requests)
+	require.NoError(t, err)
+	defer cleanup()
+
+	testCases := []struct {
+		desc   string
+		args   *commandargs.CommandArgs
+		userId string
+	}{
+		{
+			desc: "With a key id",
+			args: &commandargs.CommandArgs{GitlabKeyId: keyId},
+		},
+		{
+			desc:   "With a username resolved by the access check",
+			args:   &commandargs.CommandArgs{GitlabUsername: "jane-doe"},
+			userId: "user-1",
+		},
+		{
+			desc: "With a username only",
+			args: &commandargs.CommandArgs{GitlabUsername: "jane-doe"},
+		},
+		{
+			desc: "With the client IP",
+			args: &commandargs.CommandArgs{GitlabKeyId: "checked", SshConnection: commandargs.SshConnection{RemoteIp: "192.168.1.10"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			client, err := NewClient(&config.Config{GitlabUrl: url}, tc.args)
+			require.NoError(t, err)
+
+			response, err := client.Authenticate(operation, repo, tc.userId)
+			require.NoError(t, err)
+
+			expectedResponse := &Response{
+				Username:  "john",
+				LfsToken:  "sometoken",
+				RepoPath:  "https://gitlab.com/repo/path",
+				ExpiresIn: 1800,
+			}
+
+			require.Equal(t, expectedResponse, response)
+		})
+	}
+}
@@ -0,0 +1,443 @@
+package lfstransfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	lfsMediaType    = "application/vnd.git-lfs+json"
+	basicTransfer   = "basic"
+	defaultHashAlgo = "sha256"
+	// tokenRenewMargin renews tokens a bit early, so that they do not expire
+	// while a request is on its way
+	tokenRenewMargin = 10 * time.Second
+)
+
+// Client talks to the Git LFS API of a single repository, authenticated
+// with the token handed out by the /lfs_authenticate internal endpoint.
+type Client struct {
+	httpClient *http.Client
+	href       string
+	auth       string
+	expiresAt  time.Time
+	renew      func() (*Token, error)
+}
+
+// Token is an LFS token handed out by /lfs_authenticate
+type Token struct {
+	Authorization string
+	// ExpiresIn is the lifetime of the token in seconds, 0 if it does not
+	// expire
+	ExpiresIn int
+}
+
+type Ref struct {
+	Name string `json:"name"`
+}
+
+type Action struct {
+	Href      string            `json:"href"`
+	Header    map[string]string `json:"header,omitempty"`
+	ExpiresIn int               `json:"expires_in,omitempty"`
+	ExpiresAt string            `json:"expires_at,omitempty"`
+}
+
+type ObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type BatchObject struct {
+	Oid     string             `json:"oid"`
+	Size    int64              `json:"size"`
+	Actions map[string]*Action `json:"actions,omitempty"`
+	Error   *ObjectError       `json:"error,omitempty"`
+}
+
+type BatchRequest struct {
+	Operation string         `json:"operation"`
+	Transfers []string       `json:"transfers"`
+	Ref       *Ref           `json:"ref,omitempty"`
+	Objects   []*BatchObject `json:"objects"`
+	HashAlgo  string         `json:"hash_algo"`
+}
+
+type BatchResponse struct {
+	Transfer string         `json:"transfer"`
+	Objects  []*BatchObject `json:"objects"`
+	HashAlgo string         `json:"hash_algo"`
+}
+
+type LockOwner struct {
+	Name string `json:"name"`
+}
+
+type Lock struct {
+	Id       string     `json:"id"`
+	Path     string     `json:"path"`
+	LockedAt string     `json:"locked_at"`
+	Owner    *LockOwner `json:"owner,omitempty"`
+}
+
+type LockRequest struct {
+	Path string `json:"path"`
+	Ref  *Ref   `json:"ref,omitempty"`
+}
+
+type LockResponse struct {
+	Lock *Lock `json:"lock"`
+}
+
+type LockList struct {
+	Locks      []*Lock `json:"locks"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+type LockVerifyRequest struct {
+	Ref    *Ref   `json:"ref,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type LockVerifyList struct {
+	Ours       []*Lock `json:"ours"`
+	Theirs     []*Lock `json:"theirs"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+type UnlockRequest struct {
+	Force bool `json:"force"`
+	Ref   *Ref `json:"ref,omitempty"`
+}
+
+type VerifyRequest struct {
+	Oid  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type ErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// ApiError carries the status code of a failed LFS API call, so that it can
+// be relayed to the client as is.
+type ApiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+var (
+	errUnreachable = &ApiError{StatusCode: http.StatusBadGateway, Message: "LFS API unreachable"}
+	errBodyStopped = errors.New("request body no longer available")
+
+	// timeNow is overridden in tests
+	timeNow = time.Now
+)
+
+// NewClient returns a client for the LFS API rooted at href, that is the
+// repository HTTP path followed by /info/lfs. Once token expires, renew is
+// called to get a new one.
+func NewClient(httpClient *http.Client, href string, token *Token, renew func() (*Token, error)) *Client {
+	client := &Client{httpClient: httpClient, href: href, renew: renew}
+	client.setToken(token)
+
+	return client
+}
+
+func (c *Client) Batch(operation string, objects []*BatchObject, refname string) (*BatchResponse, error) {
+	request := &BatchRequest{
+		Operation: operation,
+		Transfers: []string{basicTransfer},
+		Ref:       newRef(refname),
+		Objects:   objects,
+		HashAlgo:  defaultHashAlgo,
+	}
+
+	response := &BatchResponse{}
+	if err := c.doJSON("POST", c.href+"/objects/batch", request, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Upload sends size bytes of body. body is not read anymore once Upload
+// returns, even if the request failed before all of it was sent.
+func (c *Client) Upload(action *Action, size int64, body io.Reader) error {
+	guardedBody := &guardedReader{r: body}
+	defer guardedBody.stop()
+
+	request, err := http.NewRequest("PUT", action.Href, guardedBody)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	response, err := c.do(request, action.Header)
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+// Download returns the body of the object and its size. The caller is
+// responsible for closing the body.
+func (c *Client) Download(action *Action) (io.ReadCloser, int64, error) {
+	request, err := http.NewRequest("GET", action.Href, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := c.do(request, action.Header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return response.Body, response.ContentLength, nil
+}
+
+func (c *Client) Verify(action *Action, oid string, size int64) error {
+	body, err := json.Marshal(&VerifyRequest{Oid: oid, Size: size})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", action.Href, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", lfsMediaType)
+	request.Header.Set("Accept", lfsMediaType)
+
+	response, err := c.do(request, action.Header)
+	if err != nil {
+		return err
+	}
+
+	return response.Body.Close()
+}
+
+// Lock creates a lock on path. When the path is already locked, the
+// existing lock is returned along with the error.
+func (c *Client) Lock(path, refname string) (*Lock, error) {
+	response := &LockResponse{}
+	err := c.doJSON("POST", c.href+"/locks", &LockRequest{Path: path, Ref: newRef(refname)}, response)
+
+	return response.Lock, err
+}
+
+func (c *Client) ListLocks(params url.Values) (*LockList, error) {
+	response := &LockList{}
+	if err := c.doJSON("GET", c.href+"/locks?"+params.Encode(), nil, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (c *Client) VerifyLocks(refname, cursor string, limit int) (*LockVerifyList, error) {
+	request := &LockVerifyRequest{Ref: newRef(refname), Cursor: cursor, Limit: limit}
+
+	response := &LockVerifyList{}
+	if err := c.doJSON("POST", c.href+"/locks/verify", request, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (c *Client) Unlock(id string, force bool, refname string) (*Lock, error) {
+	path := c.href + "/locks/" + url.PathEscape(id) + "/unlock"
+
+	response := &LockResponse{}
+	if err := c.doJSON("POST", path, &UnlockRequest{Force: force, Ref: newRef(refname)}, response); err != nil {
+		return nil, err
+	}
+
+	return response.Lock, nil
+}
+
+func (c *Client) doJSON(method, href string, data, result interface{}) error {
+	var body io.Reader
+	if data != nil {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(jsonData)
+	}
+
+	request, err := http.NewRequest(method, href, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", lfsMediaType)
+	if data != nil {
+		request.Header.Set("Content-Type", lfsMediaType)
+	}
+
+	if err := c.authenticate(request, nil); err != nil {
+		return err
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return errUnreachable
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return errUnreachable
+	}
+
+	// Error responses may carry a result too, like the conflicting lock
+	decodeErr := json.Unmarshal(responseBody, result)
+
+	if err := parseError(response.StatusCode, responseBody); err != nil {
+		return err
+	}
+
+	if decodeErr != nil {
+		return &ApiError{StatusCode: http.StatusBadGateway, Message: "Parsing failed"}
+	}
+
+	return nil
+}
+
+func (c *Client) do(request *http.Request, header map[string]string) (*http.Response, error) {
+	if err := c.authenticate(request, header); err != nil {
+		return nil, err
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, errUnreachable
+	}
+
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return response, nil
+	}
+	defer response.Body.Close()
+
+	responseBody, _ := ioutil.ReadAll(response.Body)
+
+	return nil, parseError(response.StatusCode, responseBody)
+}
+
+// authenticate uses the headers of a batch action when there are some, and
+// the LFS token otherwise. The token is only ever sent to the host of the
+// LFS API, never to the storage an action may point to.
+func (c *Client) authenticate(request *http.Request, header map[string]string) error {
+	if len(header) == 0 && c.isApiHost(request.URL) {
+		auth, err := c.authorization()
+		if err != nil {
+			return err
+		}
+
+		request.Header.Set("Authorization", auth)
+	}
+
+	for key, value := range header {
+		request.Header.Set(key, value)
+	}
+
+	return nil
+}
+
+func (c *Client) isApiHost(target *url.URL) bool {
+	apiUrl, err := url.Parse(c.href)
+	if err != nil {
+		return false
+	}
+
+	return target.Scheme == apiUrl.Scheme && target.Host == apiUrl.Host
+}
+
+// authorization returns the current token, renewing it when it expired
+func (c *Client) authorization() (string, error) {
+	if !c.expiresAt.IsZero() && !timeNow().Before(c.expiresAt) {
+		token, err := c.renew()
+		if err != nil {
+			return "", &ApiError{StatusCode: http.StatusUnauthorized, Message: fmt.Sprintf("Failed to renew the LFS token: %v", err)}
+		}
+
+		c.setToken(token)
+	}
+
+	return c.auth, nil
+}
+
+func (c *Client) setToken(token *Token) {
+	c.auth = token.Authorization
+	c.expiresAt = time.Time{}
+
+	if token.ExpiresIn > 0 && c.renew != nil {
+		c.expiresAt = timeNow().Add(time.Duration(token.ExpiresIn)*time.Second - tokenRenewMargin)
+	}
+}
+
+// guardedReader hands a reader to the HTTP transport, which may go on
+// sending the body of a failed request from its own goroutine, and takes it
+// back once stopped: its reads fail from then on, so that the transport
+// gives up and the caller can use the reader again.
+type guardedReader struct {
+	mu      sync.Mutex
+	r       io.Reader
+	stopped bool
+}
+
+func (g *guardedReader) Read(b []byte) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stopped {
+		return 0, errBodyStopped
+	}
+
+	return g.r.Read(b)
+}
+
+// stop waits for a pending read to return
+func (g *guardedReader) stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stopped = true
+}
+
+func parseError(statusCode int, body []byte) error {
+	if statusCode >= 200 && statusCode <= 299 {
+		return nil
+	}
+
+	errorResponse := &ErrorResponse{}
+	if err := json.Unmarshal(body, errorResponse); err != nil || errorResponse.Message == "" {
+		return &ApiError{StatusCode: statusCode, Message: fmt.Sprintf("LFS API error (%v)", statusCode)}
+	}
+
+	return &ApiError{StatusCode: statusCode, Message: errorResponse.Message}
+}
+
+func newRef(refname string) *Ref {
+	if refname == "" {
+		return nil
+	}
+
+	return &Ref{Name: refname}
+}
@@ -0,0 +1,175 @@
+package lfstransfer
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/gitlabnet/testserver"
+)
+
+const auth = "Basic am9objpzb21ldG9rZW4="
+
+func setup(t *testing.T) (*Client, func()) {
+	requests := []testserver.TestRequestHandler{
+		{
+			Path: "/info/lfs/objects/batch",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, auth, r.Header.Get("Authorization"))
+				require.Equal(t, "application/vnd.git-lfs+json", r.Header.Get("Accept"))
+
+				var request BatchRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+				require.Equal(t, "refs/heads/main", request.Ref.Name)
+
+				json.NewEncoder(w).Encode(&BatchResponse{Transfer: "basic", Objects: request.Objects})
+			},
+		},
+		{
+			Path: "/info/lfs/locks",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(&ErrorResponse{Message: "You must have push access"})
+			},
+		},
+		{
+			Path: "/info/lfs/locks/verify",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartHttpServer(requests)
+	require.NoError(t, err)
+
+	return NewClient(&http.Client{}, url+"/info/lfs", &Token{Authorization: auth}, nil), cleanup
+}
+
+func TestBatch(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	response, err := client.Batch("upload", []*BatchObject{{Oid: "aaaa", Size: 5}}, "refs/heads/main")
+	require.NoError(t, err)
+	require.Equal(t, "basic", response.Transfer)
+	require.Equal(t, []*BatchObject{{Oid: "aaaa", Size: 5}}, response.Objects)
+}
+
+func TestErrorResponses(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	_, err := client.Lock("file.bin", "")
+	require.Equal(t, &ApiError{StatusCode: http.StatusForbidden, Message: "You must have push access"}, err)
+
+	_, err = client.VerifyLocks("refs/heads/main", "", 0)
+	require.Equal(t, &ApiError{StatusCode: http.StatusInternalServerError, Message: "LFS API error (500)"}, err)
+
+	_, err = client.Unlock("1", false, "")
+	require.Equal(t, &ApiError{StatusCode: http.StatusNotFound, Message: "LFS API error (404)"}, err)
+}
+
+func TestActionAuthorization(t *testing.T) {
+	var authorizations []string
+	handlers := []testserver.TestRequestHandler{
+		{
+			Path: "/object",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				authorizations = append(authorizations, r.Header.Get("Authorization"))
+			},
+		},
+	}
+
+	cleanup, apiUrl, err := testserver.StartHttpServer(handlers)
+	require.NoError(t, err)
+	defer cleanup()
+
+	storageCleanup, storageUrl, err := testserver.StartHttpServer(handlers)
+	require.NoError(t, err)
+	defer storageCleanup()
+
+	client := NewClient(&http.Client{}, apiUrl+"/info/lfs", &Token{Authorization: auth}, nil)
+
+	require.NoError(t, client.Verify(&Action{Href: apiUrl + "/object"}, "aaaa", 5))
+	require.NoError(t, client.Verify(&Action{Href: storageUrl + "/object"}, "aaaa", 5))
+	require.NoError(t, client.Verify(&Action{Href: storageUrl + "/object", Header: map[string]string{"Authorization": "storage-token"}}, "aaaa", 5))
+
+	require.Equal(t, []string{auth, "", "storage-token"}, authorizations)
+}
+
+func TestTokenRenewal(t *testing.T) {
+	var authorizations []string
+	handlers := []testserver.TestRequestHandler{
+		{
+			Path: "/info/lfs/locks",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				authorizations = append(authorizations, r.Header.Get("Authorization"))
+				json.NewEncoder(w).Encode(&LockList{})
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartHttpServer(handlers)
+	require.NoError(t, err)
+	defer cleanup()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	renew := func() (*Token, error) {
+		return &Token{Authorization: "Basic renewed", ExpiresIn: 60}, nil
+	}
+	client := NewClient(&http.Client{}, url+"/info/lfs", &Token{Authorization: auth, ExpiresIn: 60}, renew)
+
+	_, err = client.ListLocks(nil)
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = client.ListLocks(nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{auth, "Basic renewed"}, authorizations)
+}
+
+type slowReader struct {
+	reads int32
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	atomic.AddInt32(&r.reads, 1)
+	time.Sleep(time.Millisecond)
+
+	b[0] = 'x'
+	return 1, nil
+}
+
+func TestFailedUploadStopsReading(t *testing.T) {
+	handlers := []testserver.TestRequestHandler{
+		{
+			Path: "/upload",
+			Handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			},
+		},
+	}
+
+	cleanup, url, err := testserver.StartHttpServer(handlers)
+	require.NoError(t, err)
+	defer cleanup()
+
+	client := NewClient(&http.Client{}, url+"/info/lfs", &Token{Authorization: auth}, nil)
+
+	body := &slowReader{}
+	err = client.Upload(&Action{Href: url + "/upload"}, 1<<20, body)
+	require.Equal(t, &ApiError{StatusCode: http.StatusForbidden, Message: "LFS API error (403)"}, err)
+
+	reads := atomic.LoadInt32(&body.reads)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, reads, atomic.LoadInt32(&body.reads))
+}
@@ -25,8 +25,9 @@ type Response struct {
 }
 
 type RequestBody struct {
-	KeyId  string `json:"key_id,omitempty"`
-	UserId int64  `json:"user_id,omitempty"`
+	KeyId   string `json:"key_id,omitempty"`
+	UserId  int64  `json:"user_id,omitempty"`
+	CheckIp string `json:"check_ip,omitempty"`
 }
 
 func NewClient(config *config.Config) (*Client, error) {
@@ -100,5 +101,7 @@ func (c *Client) getRequestBody(args *commandargs.CommandArgs) (*RequestBody, er
 		requestBody = &RequestBody{UserId: userInfo.UserId}
 	}
 
+	requestBody.CheckIp = args.SshConnection.RemoteIp
+
 	return requestBody, nil
 }
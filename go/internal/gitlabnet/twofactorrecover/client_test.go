@@ -56,6 +56,14 @@ func initialize(t *testing.T) {
 					w.Write([]byte("{ \"message\": \"broken json!\""))
 				case "4":
 					w.WriteHeader(http.StatusForbidden)
+				case "5":
+					if requestBody.CheckIp == "192.168.1.10" {
+						body := map[string]interface{}{
+							"success":        true,
+							"recovery_codes": [2]string{"recovery 5", "codes 5"},
+						}
+						json.NewEncoder(w).Encode(body)
+					}
 				}
 
 				if requestBody.UserId == 1 {
@@ -101,6 +109,16 @@ func TestGetRecoveryCodesByUsername(t *testing.T) {
 	assert.Equal(t, []string{"recovery 2", "codes 2"}, result)
 }
 
+func TestGetRecoveryCodesWithCheckIp(t *testing.T) {
+	client, cleanup := setup(t)
+	defer cleanup()
+
+	args := &commandargs.CommandArgs{GitlabKeyId: "5", SshConnection: commandargs.SshConnection{RemoteIp: "192.168.1.10"}}
+	result, err := client.GetRecoveryCodes(args)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"recovery 5", "codes 5"}, result)
+}
+
 func TestMissingUser(t *testing.T) {
 	client, cleanup := setup(t)
 	defer cleanup()
@@ -2,14 +2,19 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"gitlab.com/gitlab-org/gitaly/auth"
 	"gitlab.com/gitlab-org/gitaly/client"
 
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/admission"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/throttle"
 	"gitlab.com/gitlab-org/labkit/tracing"
 	"google.golang.org/grpc"
 )
@@ -58,8 +63,101 @@ func internalRunGitalyCommand(args []string, handler GitalyHandlerFunc) (int, er
 		return 1, err
 	}
 
+	if remoteIp := commandargs.ParseSshConnection(os.Getenv("SSH_CONNECTION")).RemoteIp; remoteIp != "" {
+		logger.SetSessionFields(map[string]interface{}{"remote_ip": remoteIp})
+	}
+
+	requestJSON := string(args[2])
+
+	// A request that doesn't parse is still handed over, it only goes
+	// without a description in the summary
+	session := &sessionRequest{}
+	json.Unmarshal([]byte(requestJSON), session)
+
+	gc := &GitalyCommand{
+		Config:         cfg,
+		ServiceName:    args[0],
+		Address:        args[1],
+		Token:          os.Getenv("GITALY_TOKEN"),
+		BandwidthLimit: throttle.NewLimit(&cfg.BandwidthLimit, session.BandwidthLimit),
+		Repo:           session.GlRepository,
+		Who:            session.GlId,
+		Username:       session.GlUsername,
+	}
+
+	exitCode, err := gc.run(func(ctx context.Context, conn *grpc.ClientConn) (int32, error) {
+		return handler(ctx, conn, requestJSON)
+	})
+	return int(exitCode), err
+}
+
+// GitalyCommand holds what is needed to talk to Gitaly from within the
+// gitlab-shell process, once the access check has returned an address
+// and token for the repository.
+type GitalyCommand struct {
+	Config      *config.Config
+	ServiceName string
+	Address     string
+	Token       string
+	// BandwidthLimit throttles the client streams, the configured one is used
+	// if it is nil
+	BandwidthLimit *throttle.Limit
+	// Repo, Who and Username describe the session in its summary
+	Repo     string
+	Who      string
+	Username string
+}
+
+// sessionRequest holds the fields every Gitaly request of the Ruby
+// implementation carries about the session. BandwidthLimit is only there
+// when GitLab overrides the configured one for the user or key.
+type sessionRequest struct {
+	GlRepository   string `json:"gl_repository"`
+	GlId           string `json:"gl_id"`
+	GlUsername     string `json:"gl_username"`
+	BandwidthLimit *int64 `json:"bandwidth_limit"`
+}
+
+// GitalyConnHandlerFunc implementations make a Gitaly call using the
+// provided connection and return the exit code or error from that call.
+type GitalyConnHandlerFunc func(ctx context.Context, conn *grpc.ClientConn) (int32, error)
+
+// ExitError carries the non-zero exit code of a Gitaly call, whose output
+// already told the client what went wrong.
+type ExitError struct {
+	Code int32
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Gitaly call exited with %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return int(e.Code)
+}
+
+// RunGitalyCommand configures tracing, dials Gitaly and executes `handler`.
+// Unlike the package level RunGitalyCommand, it returns to the caller, with
+// an ExitError if the call exited with a non-zero code.
+func (gc *GitalyCommand) RunGitalyCommand(handler GitalyConnHandlerFunc) error {
+	exitCode, err := gc.run(handler)
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		return &ExitError{Code: exitCode}
+	}
+
+	return nil
+}
+
+func (gc *GitalyCommand) run(handler GitalyConnHandlerFunc) (exitCode int32, err error) {
+	stats := &transferStats{start: time.Now()}
+	defer func() { gc.logSummary(stats, exitCode, err) }()
+
 	// Configure distributed tracing
-	serviceName := fmt.Sprintf("gitlab-shell-%v", args[0])
+	serviceName := fmt.Sprintf("gitlab-shell-%v", gc.ServiceName)
 	closer := tracing.Initialize(
 		tracing.WithServiceName(serviceName),
 
@@ -71,32 +169,38 @@ func internalRunGitalyCommand(args []string, handler GitalyHandlerFunc) (int, er
 		// Processes are spawned as children of the SSH daemon, which tightly
 		// controls environment variables; doing this means we don't have to
 		// enable PermitUserEnvironment
-		tracing.WithConnectionString(cfg.GitlabTracing),
+		tracing.WithConnectionString(gc.Config.GitlabTracing),
 	)
 	defer closer.Close()
 
 	ctx, finished := tracing.ExtractFromEnv(context.Background())
 	defer finished()
 
-	gitalyAddress := args[1]
-	if gitalyAddress == "" {
+	if gc.Address == "" {
 		return 1, fmt.Errorf("no gitaly_address given")
 	}
 
-	conn, err := client.Dial(gitalyAddress, dialOpts())
+	conn, err := client.Dial(gc.Address, dialOpts(gc.Token))
 	if err != nil {
 		return 1, err
 	}
 	defer conn.Close()
 
-	requestJSON := string(args[2])
-	exitCode, err := handler(ctx, conn, requestJSON)
-	return int(exitCode), err
+	defer admission.TrackStream(&gc.Config.Admission)()
+
+	limit := gc.BandwidthLimit
+	if limit == nil {
+		limit = throttle.NewLimit(&gc.Config.BandwidthLimit, nil)
+	}
+	ctx = throttle.NewContext(ctx, limit)
+	ctx = withTransferStats(ctx, stats)
+
+	return handler(ctx, conn)
 }
 
-func dialOpts() []grpc.DialOption {
+func dialOpts(token string) []grpc.DialOption {
 	connOpts := client.DefaultDialOpts
-	if token := os.Getenv("GITALY_TOKEN"); token != "" {
+	if token != "" {
 		connOpts = append(client.DefaultDialOpts, grpc.WithPerRPCCredentials(gitalyauth.RPCCredentialsV2(token)))
 	}
 
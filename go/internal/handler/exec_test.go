@@ -6,7 +6,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
 	"gitlab.com/gitlab-org/gitlab-shell/go/internal/testhelper"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/throttle"
 	"google.golang.org/grpc"
 )
 
@@ -101,3 +103,47 @@ func TestInteralRunHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestInternalRunHandlerBandwidthLimit(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		requestJSON string
+		expected    int64
+	}{
+		{desc: "without an override", requestJSON: `{"gl_id":"user-1"}`, expected: 0},
+		{desc: "with an override", requestJSON: `{"gl_id":"user-1","bandwidth_limit":1024}`, expected: 1024},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			// The command changes the working directory
+			done, err := testhelper.PrepareTestRootDir()
+			defer done()
+			require.NoError(t, err)
+
+			var limit *throttle.Limit
+			handler := func(ctx context.Context, _ *grpc.ClientConn, _ string) (int32, error) {
+				limit = throttle.FromContext(ctx)
+				return 0, nil
+			}
+
+			_, err = internalRunGitalyCommand([]string{"test", "tcp://localhost:9999", tc.requestJSON}, handler)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, limit.BytesPerSecond)
+		})
+	}
+}
+
+func TestRunGitalyCommandExitCode(t *testing.T) {
+	gc := &GitalyCommand{Config: &config.Config{}, ServiceName: "git-receive-pack", Address: "tcp://localhost:9999"}
+
+	err := gc.RunGitalyCommand(func(context.Context, *grpc.ClientConn) (int32, error) { return 0, nil })
+	require.NoError(t, err)
+
+	err = gc.RunGitalyCommand(func(context.Context, *grpc.ClientConn) (int32, error) { return 1, nil })
+	require.Equal(t, &ExitError{Code: 1}, err)
+	require.Equal(t, 1, err.(*ExitError).ExitCode())
+
+	err = gc.RunGitalyCommand(func(context.Context, *grpc.ClientConn) (int32, error) { return 1, fmt.Errorf("error") })
+	require.EqualError(t, err, "error")
+}
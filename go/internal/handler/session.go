@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/throttle"
+)
+
+type transferStatsKey struct{}
+
+// transferStats counts what a session moves between the SSH client and
+// Gitaly, for the summary logged once it is over.
+type transferStats struct {
+	start    time.Time
+	bytesIn  int64
+	bytesOut int64
+	bytesErr int64
+}
+
+type countingReader struct {
+	r     io.Reader
+	count *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(r.count, int64(n))
+
+	return n, err
+}
+
+type countingWriter struct {
+	w     io.Writer
+	count *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	atomic.AddInt64(w.count, int64(n))
+
+	return n, err
+}
+
+func withTransferStats(ctx context.Context, stats *transferStats) context.Context {
+	return context.WithValue(ctx, transferStatsKey{}, stats)
+}
+
+// clientStreams are the standard streams of the session, counted and
+// throttled if asked to. Stderr isn't throttled, it carries progress when
+// there is no sideband.
+func clientStreams(ctx context.Context, throttled bool) (io.Reader, io.Writer, io.Writer) {
+	var stdin io.Reader = os.Stdin
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+
+	if stats, ok := ctx.Value(transferStatsKey{}).(*transferStats); ok {
+		stdin = &countingReader{r: stdin, count: &stats.bytesIn}
+		stdout = &countingWriter{w: stdout, count: &stats.bytesOut}
+		stderr = &countingWriter{w: stderr, count: &stats.bytesErr}
+	}
+
+	if throttled {
+		limit := throttle.FromContext(ctx)
+		stdin, stdout = limit.Reader(stdin), limit.Writer(stdout)
+	}
+
+	return stdin, stdout, stderr
+}
+
+// logSummary logs the single line describing a finished session
+func (gc *GitalyCommand) logSummary(stats *transferStats, exitCode int32, err error) {
+	user := gc.Username
+	if user == "" {
+		user = gc.Who
+	}
+
+	logger.Info("session finished", map[string]interface{}{
+		"command":       filepath.Base(gc.ServiceName),
+		"gl_repository": gc.Repo,
+		"user":          user,
+		"bytes_in":      atomic.LoadInt64(&stats.bytesIn),
+		"bytes_out":     atomic.LoadInt64(&stats.bytesOut),
+		"bytes_err":     atomic.LoadInt64(&stats.bytesErr),
+		"duration_ms":   milliseconds(time.Since(stats.start)),
+		"cpu_ms":        milliseconds(cpuTime()),
+		"exit_code":     exitCode,
+		"error_class":   errorClass(err),
+	})
+}
+
+// errorClass names the gRPC status code of err, Unknown for other errors
+func errorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return status.FromContextError(err).Code().String()
+	}
+
+	return status.Convert(err).Code().String()
+}
+
+// cpuTime is the user and system time of the process, which includes the
+// time spent by the Ruby implementation before it exec'd this process
+func cpuTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+func milliseconds(d time.Duration) int64 {
+	return d.Nanoseconds() / int64(time.Millisecond)
+}
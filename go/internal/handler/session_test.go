@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCountingStreams(t *testing.T) {
+	stats := &transferStats{}
+
+	data, err := ioutil.ReadAll(&countingReader{r: strings.NewReader("0009want\n"), count: &stats.bytesIn})
+	require.NoError(t, err)
+	require.Equal(t, "0009want\n", string(data))
+
+	out := &bytes.Buffer{}
+	w := &countingWriter{w: out, count: &stats.bytesOut}
+	w.Write([]byte("PACK"))
+	w.Write([]byte("data"))
+
+	require.Equal(t, int64(9), stats.bytesIn)
+	require.Equal(t, int64(8), stats.bytesOut)
+	require.Equal(t, "PACKdata", out.String())
+}
+
+func TestErrorClass(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		err      error
+		expected string
+	}{
+		{desc: "Without an error", err: nil, expected: ""},
+		{desc: "With a gRPC error", err: status.Error(codes.Unavailable, "connection refused"), expected: "Unavailable"},
+		{desc: "With a canceled context", err: context.Canceled, expected: "Canceled"},
+		{desc: "With another error", err: errors.New("no gitaly_address given"), expected: "Unknown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.expected, errorClass(tc.err))
+		})
+	}
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"context"
-	"os"
 
 	pb "gitlab.com/gitlab-org/gitaly-proto/go/gitalypb"
 	"gitlab.com/gitlab-org/gitaly/client"
@@ -14,5 +13,7 @@ func UploadPack(ctx context.Context, conn *grpc.ClientConn, request *pb.SSHUploa
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	return client.UploadPack(ctx, conn, os.Stdin, os.Stdout, os.Stderr, request)
+	stdin, stdout, stderr := clientStreams(ctx, true)
+
+	return client.UploadPack(ctx, conn, stdin, stdout, stderr, request)
 }
@@ -0,0 +1,180 @@
+package keyindex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// The journal records the changes of the source file since the index was
+// built, so that changing a single key doesn't rebuild the whole index. It is
+// a text file next to the index, with tab separated fields:
+//
+//	base	<stamp of the source the index was built from>
+//	put	<key>	<value>
+//	delete	<key>
+//	source	<stamp of the source after the changes above>
+//
+// Changes only count once a source line follows them, and a journal whose
+// base isn't the source of the index is ignored.
+
+const (
+	journalSuffix = ".journal"
+	// Lookups read all of the journal, past this size the index is rebuilt
+	maxJournalSize = 256 * 1024
+)
+
+var (
+	ErrStale       = errors.New("Key index is stale")
+	ErrJournalFull = errors.New("Key index journal is full")
+)
+
+// Change is a set of changes of the source file to record in the journal
+type Change struct {
+	entries bytes.Buffer
+}
+
+// Put makes key map to value, replacing what the index had for it
+func (c *Change) Put(key, value string) {
+	fmt.Fprintf(&c.entries, "put\t%s\t%s\n", key, value)
+}
+
+// Delete drops key from the index
+func (c *Change) Delete(key string) {
+	fmt.Fprintf(&c.entries, "delete\t%s\n", key)
+}
+
+type journal struct {
+	// A nil value is a deleted key
+	changes map[string]*string
+	source  string
+	// size is the length of the committed part of the journal
+	size int64
+}
+
+// Record appends change to the journal. The index must have been fresh
+// before the source changed, info is the source after the change. Once the
+// journal grows too large this fails with ErrJournalFull, and the index
+// should be rebuilt.
+func (i *Index) Record(change *Change, info os.FileInfo) error {
+	file, err := os.OpenFile(i.path+journalSuffix, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var entries bytes.Buffer
+	size := int64(0)
+
+	if i.journal != nil {
+		size = i.journal.size
+	} else {
+		source, found, err := i.Get(sourceKey)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return ErrStale
+		}
+
+		fmt.Fprintf(&entries, "base\t%s\n", source)
+	}
+
+	entries.Write(change.entries.Bytes())
+	fmt.Fprintf(&entries, "source\t%s\n", stamp(info))
+
+	if size+int64(entries.Len()) > maxJournalSize {
+		return ErrJournalFull
+	}
+
+	// Drops what a failed writer may have left after the committed part
+	if err := file.Truncate(size); err != nil {
+		return err
+	}
+
+	if _, err := file.WriteAt(entries.Bytes(), size); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	return i.readJournal()
+}
+
+// readJournal loads the committed changes of the journal that belongs to
+// the index, if there is one.
+func (i *Index) readJournal() error {
+	file, err := os.Open(i.path + journalSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, maxJournalSize+1))
+	if err != nil || len(data) > maxJournalSize {
+		return err
+	}
+
+	base, found, err := i.Get(sourceKey)
+	if err != nil || !found {
+		return err
+	}
+
+	j := &journal{changes: make(map[string]*string)}
+	pending := make(map[string]*string)
+	var pos int64
+
+	for n := 0; ; n++ {
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end < 0 {
+			break
+		}
+
+		fields := strings.SplitN(string(data[pos:pos+int64(end)]), "\t", 3)
+		pos += int64(end + 1)
+
+		switch {
+		case n == 0:
+			// The journal of a previous index
+			if len(fields) != 2 || fields[0] != "base" || fields[1] != base {
+				return nil
+			}
+		case len(fields) == 3 && fields[0] == "put":
+			pending[fields[1]] = &fields[2]
+		case len(fields) == 2 && fields[0] == "delete":
+			pending[fields[1]] = nil
+		case len(fields) == 2 && fields[0] == "source":
+			for key, value := range pending {
+				j.changes[key] = value
+			}
+			pending = make(map[string]*string)
+
+			j.source = fields[1]
+			j.size = pos
+		default:
+			return nil
+		}
+	}
+
+	if j.size > 0 {
+		i.journal = j
+	}
+
+	return nil
+}
+
+func removeJournal(path string) error {
+	if err := os.Remove(path + journalSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package keyindex
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildWithSource builds an index of entries from a source file, and returns
+// the path of the source
+func buildWithSource(t *testing.T, path string, entries [][2]string) string {
+	source := filepath.Join(filepath.Dir(path), "authorized_keys")
+	require.NoError(t, ioutil.WriteFile(source, []byte("key-1\n"), 0600))
+
+	info, err := os.Stat(source)
+	require.NoError(t, err)
+
+	w, err := Create(path)
+	require.NoError(t, err)
+	require.NoError(t, w.SetSource(info))
+	for _, entry := range entries {
+		require.NoError(t, w.Add(entry[0], entry[1]))
+	}
+	require.NoError(t, w.Commit())
+
+	return source
+}
+
+// changeSource changes the source and records change in the journal
+func changeSource(t *testing.T, path, source string, change *Change) {
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	fresh, err := index.Fresh(source)
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	info := touch(t, source)
+	require.NoError(t, index.Record(change, info))
+}
+
+func touch(t *testing.T, source string) os.FileInfo {
+	info, err := os.Stat(source)
+	require.NoError(t, err)
+
+	mtime := info.ModTime().Add(time.Second)
+	require.NoError(t, os.Chtimes(source, mtime, mtime))
+
+	info, err = os.Stat(source)
+	require.NoError(t, err)
+
+	return info
+}
+
+func requireValues(t *testing.T, path, source string, expected map[string]string) {
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	fresh, err := index.Fresh(source)
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	for key, expectedValue := range expected {
+		value, found, err := index.Get(key)
+		require.NoError(t, err)
+		require.Equal(t, expectedValue != "", found, key)
+		require.Equal(t, expectedValue, value)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	source := buildWithSource(t, path, [][2]string{{"AAAA1", "key-1"}, {"AAAA2", "key-2"}})
+
+	change := &Change{}
+	change.Put("AAAA3", "key-3\twith a tab")
+	change.Delete("AAAA1")
+	changeSource(t, path, source, change)
+
+	requireValues(t, path, source, map[string]string{"AAAA1": "", "AAAA2": "key-2", "AAAA3": "key-3\twith a tab"})
+
+	change = &Change{}
+	change.Put("AAAA1", "key-1 again")
+	change.Delete("AAAA3")
+	changeSource(t, path, source, change)
+
+	requireValues(t, path, source, map[string]string{"AAAA1": "key-1 again", "AAAA2": "key-2", "AAAA3": ""})
+
+	// Rebuilding drops the journal
+	source = buildWithSource(t, path, [][2]string{{"AAAA2", "key-2"}})
+	requireValues(t, path, source, map[string]string{"AAAA1": "", "AAAA2": "key-2", "AAAA3": ""})
+
+	_, err := os.Stat(path + journalSuffix)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestJournalIgnoresUncommittedChanges(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	source := buildWithSource(t, path, [][2]string{{"AAAA1", "key-1"}})
+
+	change := &Change{}
+	change.Put("AAAA2", "key-2")
+	changeSource(t, path, source, change)
+
+	// Such as a writer that failed half way
+	file, err := os.OpenFile(path+journalSuffix, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString("delete\tAAAA2\nput\tAAAA3\tkey-3\nsou")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	requireValues(t, path, source, map[string]string{"AAAA1": "key-1", "AAAA2": "key-2", "AAAA3": ""})
+
+	change = &Change{}
+	change.Put("AAAA4", "key-4")
+	changeSource(t, path, source, change)
+
+	requireValues(t, path, source, map[string]string{"AAAA2": "key-2", "AAAA3": "", "AAAA4": "key-4"})
+
+	journal, err := ioutil.ReadFile(path + journalSuffix)
+	require.NoError(t, err)
+	require.NotContains(t, string(journal), "AAAA3")
+}
+
+func TestJournalOfAnotherIndexIsIgnored(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	source := buildWithSource(t, path, [][2]string{{"AAAA1", "key-1"}})
+
+	change := &Change{}
+	change.Delete("AAAA1")
+	changeSource(t, path, source, change)
+
+	journal, err := ioutil.ReadFile(path + journalSuffix)
+	require.NoError(t, err)
+
+	// Rebuilding drops the journal, a journal that is left over anyway
+	// doesn't apply to the new index
+	source = buildWithSource(t, path, [][2]string{{"AAAA1", "key-1"}})
+	require.NoError(t, ioutil.WriteFile(path+journalSuffix, journal, 0600))
+
+	requireValues(t, path, source, map[string]string{"AAAA1": "key-1"})
+}
+
+func TestJournalFull(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	source := buildWithSource(t, path, nil)
+
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	change := &Change{}
+	change.Put("AAAA1", strings.Repeat("x", maxJournalSize))
+
+	require.Equal(t, ErrJournalFull, index.Record(change, touch(t, source)))
+}
+
+func TestRecordWithoutSource(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	build(t, path, nil)
+
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	require.Equal(t, ErrStale, index.Record(&Change{}, info))
+}
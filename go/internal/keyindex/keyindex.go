@@ -0,0 +1,195 @@
+// Package keyindex implements an on-disk index of public keys in the
+// constant database (cdb) format, so that a key is found with a couple of
+// reads however many keys there are.
+//
+// The file starts with 256 pointers to hash tables, followed by the records
+// and the hash tables themselves. All numbers are little-endian uint32.
+package keyindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	tableCount = 256
+	headerSize = tableCount * 8
+	// sourceKey holds the stamp of the file the index was built from. Keys
+	// are base64 blobs and fingerprints, which never start with a NUL byte.
+	sourceKey = "\x00source"
+)
+
+var (
+	ErrCorrupt = errors.New("Key index is corrupt")
+)
+
+// Index is an index opened for lookups, along with its journal
+type Index struct {
+	path    string
+	file    *os.File
+	journal *journal
+}
+
+func Open(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Index{path: path, file: file}
+	if err := i.readJournal(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// Get returns the value stored for key, the first one if there are several
+func (i *Index) Get(key string) (string, bool, error) {
+	if i.journal != nil {
+		if value, changed := i.journal.changes[key]; changed {
+			return stringValue(value), value != nil, nil
+		}
+	}
+
+	h := hash([]byte(key))
+
+	tablePos, slotCount, err := i.readPair(int64(h%tableCount) * 8)
+	if err != nil || slotCount == 0 {
+		return "", false, err
+	}
+
+	start := (h / tableCount) % slotCount
+
+	for n := uint32(0); n < slotCount; n++ {
+		slot := (start + n) % slotCount
+
+		slotHash, recordPos, err := i.readPair(int64(tablePos) + int64(slot)*8)
+		if err != nil {
+			return "", false, err
+		}
+
+		if recordPos == 0 {
+			return "", false, nil
+		}
+
+		if slotHash != h {
+			continue
+		}
+
+		value, found, err := i.readRecord(int64(recordPos), key)
+		if err != nil || found {
+			return value, found, err
+		}
+	}
+
+	return "", false, nil
+}
+
+// Fresh tells whether the file at path is still as it was when the index was
+// built from it, see Writer.SetSource, or when the journal last recorded a
+// change of it. Indexes without a source are stale.
+func (i *Index) Fresh(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if i.journal != nil {
+		return i.journal.source == stamp(info), nil
+	}
+
+	source, found, err := i.Get(sourceKey)
+	if err != nil || !found {
+		return false, err
+	}
+
+	return source == stamp(info), nil
+}
+
+func (i *Index) Close() error {
+	return i.file.Close()
+}
+
+func (i *Index) readRecord(pos int64, key string) (string, bool, error) {
+	keyLen, valueLen, err := i.readPair(pos)
+	if err != nil {
+		return "", false, err
+	}
+
+	if int(keyLen) != len(key) {
+		return "", false, nil
+	}
+
+	record := make([]byte, keyLen+valueLen)
+	if _, err := i.file.ReadAt(record, pos+8); err != nil {
+		return "", false, corrupt(err)
+	}
+
+	if !bytes.Equal(record[:keyLen], []byte(key)) {
+		return "", false, nil
+	}
+
+	return string(record[keyLen:]), true, nil
+}
+
+func (i *Index) readPair(pos int64) (uint32, uint32, error) {
+	var buf [8]byte
+	if _, err := i.file.ReadAt(buf[:], pos); err != nil {
+		return 0, 0, corrupt(err)
+	}
+
+	return binary.LittleEndian.Uint32(buf[:4]), binary.LittleEndian.Uint32(buf[4:]), nil
+}
+
+// stamp identifies a version of a file, any write changes its size or
+// modification time and replacing it changes its inode
+func stamp(info os.FileInfo) string {
+	var dev, ino uint64
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		dev, ino = uint64(sys.Dev), uint64(sys.Ino)
+	}
+
+	return fmt.Sprintf("%d:%d:%d:%d", dev, ino, info.Size(), info.ModTime().UnixNano())
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
+
+func corrupt(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorrupt
+	}
+
+	return err
+}
+
+// hash is the cdb hash function
+func hash(data []byte) uint32 {
+	h := uint32(5381)
+	for _, b := range data {
+		h = ((h << 5) + h) ^ uint32(b)
+	}
+
+	return h
+}
+
+// Remove removes the index at path and its journal
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return removeJournal(path)
+}
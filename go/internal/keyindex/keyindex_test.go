@@ -0,0 +1,152 @@
+package keyindex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "keyindex")
+	require.NoError(t, err)
+
+	return filepath.Join(dir, "authorized_keys.index"), func() { os.RemoveAll(dir) }
+}
+
+func build(t *testing.T, path string, entries [][2]string) {
+	w, err := Create(path)
+	require.NoError(t, err)
+
+	for _, entry := range entries {
+		require.NoError(t, w.Add(entry[0], entry[1]))
+	}
+
+	require.NoError(t, w.Commit())
+}
+
+func TestGet(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	var entries [][2]string
+	for i := 0; i < 5000; i++ {
+		entries = append(entries, [2]string{fmt.Sprintf("AAAA%d", i), fmt.Sprintf("key-%d", i)})
+	}
+	entries = append(entries, [2]string{"AAAA42", "key-duplicate"}, [2]string{"", "empty"})
+	build(t, path, entries)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	for i := 0; i < 5000; i++ {
+		value, found, err := index.Get(fmt.Sprintf("AAAA%d", i))
+		require.NoError(t, err)
+		require.True(t, found)
+		require.Equal(t, fmt.Sprintf("key-%d", i), value)
+	}
+
+	value, found, err := index.Get("")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "empty", value)
+
+	for _, key := range []string{"AAAA5000", "BBBB", "AAAA4"} {
+		_, found, err := index.Get(key + "x")
+		require.NoError(t, err)
+		require.False(t, found)
+	}
+}
+
+func TestEmptyIndex(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	build(t, path, nil)
+
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	_, found, err := index.Get("AAAA")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+func TestCorruptIndex(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	build(t, path, [][2]string{{"AAAA", "key-1"}})
+	require.NoError(t, os.Truncate(path, headerSize+4))
+
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	_, _, err = index.Get("AAAA")
+	require.Equal(t, ErrCorrupt, err)
+}
+
+func TestAbort(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	w, err := Create(path)
+	require.NoError(t, err)
+	require.NoError(t, w.Add("AAAA", "key-1"))
+	w.Abort()
+
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestFresh(t *testing.T) {
+	path, cleanup := setup(t)
+	defer cleanup()
+
+	source := filepath.Join(filepath.Dir(path), "authorized_keys")
+	require.NoError(t, ioutil.WriteFile(source, []byte("key-1\n"), 0600))
+	info, err := os.Stat(source)
+	require.NoError(t, err)
+
+	w, err := Create(path)
+	require.NoError(t, err)
+	require.NoError(t, w.SetSource(info))
+	require.NoError(t, w.Commit())
+
+	index, err := Open(path)
+	require.NoError(t, err)
+	defer index.Close()
+
+	fresh, err := index.Fresh(source)
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	require.NoError(t, ioutil.WriteFile(source, []byte("key-2\n"), 0600))
+	require.NoError(t, os.Chtimes(source, info.ModTime(), info.ModTime().Add(time.Second)))
+
+	fresh, err = index.Fresh(source)
+	require.NoError(t, err)
+	require.False(t, fresh)
+
+	// Indexes without a source are never fresh
+	build(t, path, nil)
+	other, err := Open(path)
+	require.NoError(t, err)
+	defer other.Close()
+
+	fresh, err = other.Fresh(source)
+	require.NoError(t, err)
+	require.False(t, fresh)
+}
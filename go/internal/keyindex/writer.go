@@ -0,0 +1,179 @@
+package keyindex
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrTooLarge = errors.New("Key index would exceed 4GB")
+)
+
+type slot struct {
+	hash uint32
+	pos  uint32
+}
+
+// Writer builds a new index next to the one at path. Readers keep seeing the
+// previous index until Commit renames the new one into place and drops its
+// journal.
+type Writer struct {
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	pos    uint32
+	slots  [tableCount][]slot
+}
+
+func Create(path string) (*Writer, error) {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{path: path, file: file, pos: headerSize}
+
+	if err := file.Chmod(0600); err != nil {
+		w.Abort()
+		return nil, err
+	}
+
+	// The header is written last, once the tables are known
+	if _, err := file.Seek(headerSize, io.SeekStart); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	w.writer = bufio.NewWriter(file)
+
+	return w, nil
+}
+
+func (w *Writer) Add(key, value string) error {
+	if err := w.reserve(8 + len(key) + len(value)); err != nil {
+		return err
+	}
+
+	h := hash([]byte(key))
+	w.slots[h%tableCount] = append(w.slots[h%tableCount], slot{hash: h, pos: w.pos})
+
+	if err := w.writePair(uint32(len(key)), uint32(len(value))); err != nil {
+		return err
+	}
+
+	if _, err := w.writer.WriteString(key); err != nil {
+		return err
+	}
+
+	if _, err := w.writer.WriteString(value); err != nil {
+		return err
+	}
+
+	w.pos += uint32(8 + len(key) + len(value))
+
+	return nil
+}
+
+// SetSource records the state of the file the index is built from, info
+// being taken before reading it. Lookups can then tell whether the file
+// changed since.
+func (w *Writer) SetSource(info os.FileInfo) error {
+	return w.Add(sourceKey, stamp(info))
+}
+
+// Commit writes the hash tables and atomically replaces the index
+func (w *Writer) Commit() error {
+	defer w.Abort()
+
+	var header [headerSize]byte
+
+	for i, slots := range w.slots {
+		// Tables are half empty, which keeps the probe sequences short
+		table := make([]slot, len(slots)*2)
+		for _, s := range slots {
+			n := (s.hash / tableCount) % uint32(len(table))
+			for table[n].pos != 0 {
+				n = (n + 1) % uint32(len(table))
+			}
+			table[n] = s
+		}
+
+		binary.LittleEndian.PutUint32(header[i*8:], w.pos)
+		binary.LittleEndian.PutUint32(header[i*8+4:], uint32(len(table)))
+
+		if err := w.reserve(len(table) * 8); err != nil {
+			return err
+		}
+
+		for _, s := range table {
+			if err := w.writePair(s.hash, s.pos); err != nil {
+				return err
+			}
+		}
+
+		w.pos += uint32(len(table) * 8)
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := w.file.WriteAt(header[:], 0); err != nil {
+		return err
+	}
+
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(w.file.Name(), w.path); err != nil {
+		return err
+	}
+
+	// The new index has all the changes, and its source no longer is the
+	// base of the journal anyway
+	if err := removeJournal(w.path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(w.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// Abort drops the new index. It is a no-op after Commit.
+func (w *Writer) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+func (w *Writer) reserve(size int) error {
+	if uint64(w.pos)+uint64(size) > math.MaxUint32 {
+		return ErrTooLarge
+	}
+
+	return nil
+}
+
+func (w *Writer) writePair(a, b uint32) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint32(buf[:4], a)
+	binary.LittleEndian.PutUint32(buf[4:], b)
+
+	_, err := w.writer.Write(buf[:])
+
+	return err
+}
@@ -0,0 +1,84 @@
+package keyline
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	keyRegex = regexp.MustCompile(`\A[a-z0-9-]+\z`)
+)
+
+const (
+	PublicKeyPrefix = "key"
+	PrincipalPrefix = "username"
+	SshOptions      = "no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty"
+)
+
+// KeyLine is a single authorized_keys entry restricting a key to running
+// gitlab-shell with the given id.
+type KeyLine struct {
+	Id      string // This can be either an ID of a Key or username
+	Value   string // This can be either a public key or a principal name
+	Prefix  string
+	RootDir string
+	Options *Options
+}
+
+func NewPublicKeyLine(id string, publicKey string, rootDir string) (*KeyLine, error) {
+	return newKeyLine(id, publicKey, PublicKeyPrefix, rootDir)
+}
+
+func NewPrincipalKeyLine(keyId string, principal string, rootDir string) (*KeyLine, error) {
+	return newKeyLine(keyId, principal, PrincipalPrefix, rootDir)
+}
+
+// NewKeyLine builds a line for a full identifier such as key-1 or
+// username-someuser, as gitlab-keys receives them.
+func NewKeyLine(who string, value string, rootDir string) (*KeyLine, error) {
+	parts := strings.SplitN(who, "-", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid key_id: %s", who)
+	}
+
+	return newKeyLine(parts[1], value, parts[0], rootDir)
+}
+
+// Command is the command sshd runs for the key, which gitlab-keys also uses to
+// find the line of a key.
+func (k *KeyLine) Command() string {
+	return fmt.Sprintf("%s %s-%s", path.Join(k.RootDir, "bin", "gitlab-shell"), k.Prefix, k.Id)
+}
+
+func (k *KeyLine) ToString() string {
+	options := SshOptions
+	if k.Options != nil {
+		options = k.Options.String()
+	}
+
+	// The command comes first, gitlab-keys finds the lines of keys by it
+	return fmt.Sprintf(`command="%s",%s %s`, k.Command(), options, k.Value)
+}
+
+func newKeyLine(id string, value string, prefix string, rootDir string) (*KeyLine, error) {
+	if err := validate(id, value, prefix); err != nil {
+		return nil, err
+	}
+
+	return &KeyLine{Id: id, Value: strings.TrimRight(value, "\r\n"), Prefix: prefix, RootDir: rootDir}, nil
+}
+
+func validate(id string, value string, prefix string) error {
+	if !keyRegex.MatchString(fmt.Sprintf("%s-%s", prefix, id)) {
+		return fmt.Errorf("Invalid key_id: %s-%s", prefix, id)
+	}
+
+	if strings.Contains(strings.TrimRight(value, "\r\n"), "\n") {
+		return errors.New("Invalid value: contains a newline")
+	}
+
+	return nil
+}
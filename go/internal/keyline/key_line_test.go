@@ -0,0 +1,70 @@
+package keyline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicKeyLine(t *testing.T) {
+	line, err := NewPublicKeyLine("1", "ssh-rsa AAAA\n", "/tmp")
+	require.NoError(t, err)
+
+	require.Equal(t, `command="/tmp/bin/gitlab-shell key-1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa AAAA`, line.ToString())
+}
+
+func TestPrincipalKeyLine(t *testing.T) {
+	line, err := NewPrincipalKeyLine("someuser", "sshUsers", "/tmp")
+	require.NoError(t, err)
+
+	require.Equal(t, `command="/tmp/bin/gitlab-shell username-someuser",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty sshUsers`, line.ToString())
+}
+
+func TestKeyLine(t *testing.T) {
+	line, err := NewKeyLine("key-741", "ssh-rsa AAAAB3NzaDAxx2E", "/tmp")
+	require.NoError(t, err)
+
+	require.Equal(t, "/tmp/bin/gitlab-shell key-741", line.Command())
+	require.Equal(t, `command="/tmp/bin/gitlab-shell key-741",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa AAAAB3NzaDAxx2E`, line.ToString())
+
+	_, err = NewKeyLine("741", "ssh-rsa AAAAB3NzaDAxx2E", "/tmp")
+	require.EqualError(t, err, "Invalid key_id: 741")
+}
+
+func TestFailingNewPublicKeyLine(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		id            string
+		publicKey     string
+		expectedError string
+	}{
+		{
+			desc:          "With invalid id",
+			id:            "invalid id",
+			publicKey:     "ssh-rsa AAAA",
+			expectedError: "Invalid key_id: key-invalid id",
+		},
+		{
+			desc:          "With invalid value",
+			id:            "1",
+			publicKey:     "ssh-rsa AAAA\nssh-rsa BBBB",
+			expectedError: "Invalid value: contains a newline",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			result, err := NewPublicKeyLine(tc.id, tc.publicKey, "/tmp")
+
+			require.Empty(t, result)
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestFailingNewPrincipalKeyLine(t *testing.T) {
+	result, err := NewPrincipalKeyLine("Some User", "sshUsers", "/tmp")
+
+	require.Empty(t, result)
+	require.EqualError(t, err, "Invalid key_id: username-Some User")
+}
@@ -0,0 +1,57 @@
+package keyline
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	expiryTimeFormat = "20060102150405Z"
+)
+
+// Options are restrictions on a key that sshd enforces on top of SshOptions
+type Options struct {
+	// From lists the patterns of addresses the key may be used from
+	From []string
+	// ExpiryTime is when sshd stops accepting the key, never when zero
+	ExpiryTime time.Time
+	// Restrict disables every capability not explicitly allowed
+	Restrict bool
+}
+
+// SetOptions adds restrictions to the line, rejecting those that can't be
+// rendered as valid OpenSSH options.
+func (k *KeyLine) SetOptions(options *Options) error {
+	if options != nil {
+		for _, pattern := range options.From {
+			if pattern == "" || strings.ContainsAny(pattern, "\",\\ \t\r\n") {
+				return fmt.Errorf("Invalid from pattern: %q", pattern)
+			}
+		}
+	}
+
+	k.Options = options
+
+	return nil
+}
+
+func (o *Options) String() string {
+	var options []string
+
+	if o.Restrict {
+		options = append(options, "restrict")
+	}
+
+	options = append(options, SshOptions)
+
+	if len(o.From) > 0 {
+		options = append(options, fmt.Sprintf(`from="%s"`, strings.Join(o.From, ",")))
+	}
+
+	if !o.ExpiryTime.IsZero() {
+		options = append(options, fmt.Sprintf(`expiry-time="%s"`, o.ExpiryTime.UTC().Format(expiryTimeFormat)))
+	}
+
+	return strings.Join(options, ",")
+}
@@ -0,0 +1,49 @@
+package keyline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyLineWithOptions(t *testing.T) {
+	expiryTime := time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+
+	testCases := []struct {
+		desc         string
+		options      *Options
+		expectedLine string
+	}{
+		{
+			desc:         "Without options",
+			options:      &Options{},
+			expectedLine: `command="/tmp/bin/gitlab-shell key-1",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty ssh-rsa AAAA`,
+		},
+		{
+			desc:         "With every option",
+			options:      &Options{From: []string{"10.0.0.0/8", "!10.0.0.1", "*.example.com"}, ExpiryTime: expiryTime, Restrict: true},
+			expectedLine: `command="/tmp/bin/gitlab-shell key-1",restrict,no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty,from="10.0.0.0/8,!10.0.0.1,*.example.com",expiry-time="20300102020405Z" ssh-rsa AAAA`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			line, err := NewPublicKeyLine("1", "ssh-rsa AAAA", "/tmp")
+			require.NoError(t, err)
+
+			require.NoError(t, line.SetOptions(tc.options))
+			require.Equal(t, tc.expectedLine, line.ToString())
+		})
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	line, err := NewPublicKeyLine("1", "ssh-rsa AAAA", "/tmp")
+	require.NoError(t, err)
+
+	for _, pattern := range []string{"", `10.0.0.1",command="evil`, "10.0.0.1 ", "a,b"} {
+		require.Error(t, line.SetOptions(&Options{From: []string{pattern}}), pattern)
+	}
+	require.Nil(t, line.Options)
+}
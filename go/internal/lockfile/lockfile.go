@@ -0,0 +1,140 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	minRetryInterval = 10 * time.Millisecond
+	maxRetryInterval = 200 * time.Millisecond
+)
+
+var (
+	ErrTimeout = errors.New("Timed out waiting for lock")
+
+	// held are kept open until the process exits, the kernel then releases
+	// their locks however the process ended
+	held []*LockFile
+)
+
+// LockFile is an exclusive flock(2) held on a file.
+type LockFile struct {
+	file *os.File
+}
+
+// Lock takes an exclusive lock on path, creating the file if needed. Unlike a
+// blocking flock(2), it gives up with ErrTimeout once timeout has passed.
+func Lock(path string, timeout time.Duration) (*LockFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	interval := minRetryInterval
+
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return &LockFile{file: file}, nil
+		}
+
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			return nil, err
+		}
+
+		if !time.Now().Add(interval).Before(deadline) {
+			file.Close()
+			return nil, ErrTimeout
+		}
+
+		time.Sleep(interval)
+
+		if interval *= 2; interval > maxRetryInterval {
+			interval = maxRetryInterval
+		}
+	}
+}
+
+// TryLock takes an exclusive lock on path like Lock, but returns a nil
+// LockFile at once if somebody else holds it.
+func TryLock(path string) (*LockFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+
+		if err == syscall.EWOULDBLOCK {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &LockFile{file: file}, nil
+}
+
+// AcquireSlot locks the first free one of count slot files, named prefix
+// followed by the number of the slot, so that at most count processes hold
+// one at a time. The slot is inherited across exec, as the Ruby
+// implementation may replace the process. It returns a nil LockFile when all
+// the slots are taken.
+func AcquireSlot(prefix string, count int) (*LockFile, error) {
+	for i := 0; i < count; i++ {
+		slot, err := TryLock(prefix + strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+
+		if slot != nil {
+			if err := slot.KeepOnExec(); err != nil {
+				slot.Unlock()
+				return nil, err
+			}
+
+			return slot, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// HoldUntilExit keeps the lock until the process and the programs it execs
+// exit, however they end.
+func (l *LockFile) HoldUntilExit() {
+	held = append(held, l)
+}
+
+// ReleaseHeld unlocks the locks kept by HoldUntilExit, which tests use to
+// start over.
+func ReleaseHeld() {
+	for _, l := range held {
+		l.Unlock()
+	}
+
+	held = nil
+}
+
+// KeepOnExec lets the programs the process execs inherit the lock, which is
+// then only released once they exit.
+func (l *LockFile) KeepOnExec() error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, l.file.Fd(), syscall.F_SETFD, 0); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+func (l *LockFile) Unlock() error {
+	defer l.file.Close()
+
+	return syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,88 @@
+package lockfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "authorized_keys.lock")
+
+	lock, err := Lock(path, time.Second)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = Lock(path, 100*time.Millisecond)
+	require.Equal(t, ErrTimeout, err)
+	require.True(t, time.Since(start) < time.Second)
+
+	go func(held *LockFile) {
+		time.Sleep(50 * time.Millisecond)
+		held.Unlock()
+	}(lock)
+
+	next, err := Lock(path, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, next.Unlock())
+}
+
+func TestTryLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "slot")
+
+	lock, err := TryLock(path)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+	require.NoError(t, lock.KeepOnExec())
+
+	busy, err := TryLock(path)
+	require.NoError(t, err)
+	require.Nil(t, busy)
+
+	require.NoError(t, lock.Unlock())
+
+	lock, err = TryLock(path)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+	require.NoError(t, lock.Unlock())
+}
+
+func TestAcquireSlot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lockfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer ReleaseHeld()
+
+	prefix := filepath.Join(dir, "slot-")
+
+	for i := 0; i < 2; i++ {
+		slot, err := AcquireSlot(prefix, 2)
+		require.NoError(t, err)
+		require.NotNil(t, slot)
+		slot.HoldUntilExit()
+	}
+
+	slot, err := AcquireSlot(prefix, 2)
+	require.NoError(t, err)
+	require.Nil(t, slot)
+
+	ReleaseHeld()
+
+	slot, err = AcquireSlot(prefix, 2)
+	require.NoError(t, err)
+	require.NotNil(t, slot)
+	require.Equal(t, prefix+"0", slot.file.Name())
+	require.NoError(t, slot.Unlock())
+}
@@ -18,6 +18,7 @@ var (
 	bootstrapLogger *golog.Logger
 	pid             int
 	mutex           sync.Mutex
+	sessionFields   log.Fields
 	ProgName        string
 )
 
@@ -41,6 +42,15 @@ func Configure(cfg *config.Config) error {
 	return nil
 }
 
+// SetSessionFields sets fields logged along with every following message,
+// such as the address of the client this process serves.
+func SetSessionFields(fields map[string]interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	sessionFields = fields
+}
+
 func logPrint(msg string, err error) {
 	mutex.Lock()
 	defer mutex.Unlock()
@@ -50,11 +60,41 @@ func logPrint(msg string, err error) {
 		return
 	}
 
-	log.WithError(err).WithFields(log.Fields{
+	log.WithError(err).WithFields(sessionFields).WithFields(log.Fields{
 		"pid": pid,
 	}).Error(msg)
 }
 
+// Info logs msg along with fields. Nothing is logged unless Configure
+// succeeded.
+func Info(msg string, fields map[string]interface{}) {
+	logWithFields(log.InfoLevel, msg, fields)
+}
+
+// Warn logs msg along with fields. Nothing is logged unless Configure
+// succeeded.
+func Warn(msg string, fields map[string]interface{}) {
+	logWithFields(log.WarnLevel, msg, fields)
+}
+
+func logWithFields(level log.Level, msg string, fields map[string]interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if logWriter == nil {
+		return
+	}
+
+	entry := log.WithFields(sessionFields).WithFields(fields).WithField("pid", pid)
+
+	switch level {
+	case log.WarnLevel:
+		entry.Warn(msg)
+	default:
+		entry.Info(msg)
+	}
+}
+
 func Fatal(msg string, err error) {
 	logPrint(msg, err)
 	// We don't show the error to the end user because it can leak
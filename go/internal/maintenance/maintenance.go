@@ -0,0 +1,111 @@
+// Package maintenance refuses commands while gitlab-shell is in read-only or
+// drain mode. The mode is read on every invocation, so that it switches
+// without restarting anything.
+package maintenance
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+const (
+	Off      = ""
+	ReadOnly = "read_only"
+	Drain    = "drain"
+
+	// Exit codes from sysexits.h, so that scripts can tell refusals apart
+	ReadOnlyExitCode = 69 // EX_UNAVAILABLE
+	DrainExitCode    = 75 // EX_TEMPFAIL
+
+	readOnlyMessage = "The GitLab server is in read-only mode for maintenance, pushes are disabled."
+	drainMessage    = "The GitLab server is under maintenance. Please try again in a few minutes."
+)
+
+// Error is the refusal of a command, along with the code to exit with
+type Error struct {
+	Message  string
+	exitCode int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) UserMessage() string {
+	return e.Message
+}
+
+func (e *Error) ExitCode() int {
+	return e.exitCode
+}
+
+// Mode is the most restrictive of the configured mode and the one in the
+// flag file.
+func Mode(cfg *config.MaintenanceConfig) string {
+	mode := cfg.Mode
+
+	if cfg.FlagFile == "" {
+		// Not set up by config.NewFromDir
+	} else if content, err := ioutil.ReadFile(cfg.FlagFile); err == nil {
+		if fileMode := strings.TrimSpace(string(content)); fileMode == ReadOnly {
+			if mode == Off {
+				mode = ReadOnly
+			}
+		} else {
+			// An empty or unknown mode is safest as a drain
+			mode = Drain
+		}
+	} else if !os.IsNotExist(err) {
+		logger.Warn("Failed to read the maintenance flag file", map[string]interface{}{"error": err.Error()})
+	}
+
+	if mode != Off && mode != ReadOnly {
+		mode = Drain
+	}
+
+	return mode
+}
+
+// Check refuses the command described by args if the current mode doesn't
+// allow it.
+func Check(cfg *config.Config, args *commandargs.CommandArgs) error {
+	var refusal *Error
+
+	switch Mode(&cfg.Maintenance) {
+	case ReadOnly:
+		if isWrite(args) {
+			refusal = &Error{Message: readOnlyMessage, exitCode: ReadOnlyExitCode}
+		}
+	case Drain:
+		refusal = &Error{Message: drainMessage, exitCode: DrainExitCode}
+	}
+
+	if refusal == nil {
+		return nil
+	}
+
+	logger.Warn("Refused command for maintenance", map[string]interface{}{"command": args.SshCommand, "exit_code": refusal.exitCode})
+
+	if cfg.Maintenance.Message != "" {
+		refusal.Message += "\n" + cfg.Maintenance.Message
+	}
+
+	return refusal
+}
+
+// isWrite tells whether the command pushes, either Git or LFS objects
+func isWrite(args *commandargs.CommandArgs) bool {
+	switch args.CommandType {
+	case commandargs.ReceivePack:
+		return true
+	case commandargs.LfsAuthenticate, commandargs.LfsTransfer:
+		return len(args.SshArgs) > 2 && args.SshArgs[2] == "upload"
+	}
+
+	return false
+}
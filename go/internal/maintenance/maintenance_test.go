@@ -0,0 +1,104 @@
+package maintenance
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+)
+
+func TestMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maintenance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	flagFile := filepath.Join(dir, "maintenance")
+
+	testCases := []struct {
+		desc         string
+		mode         string
+		flagFile     *string
+		expectedMode string
+	}{
+		{desc: "Without a mode", expectedMode: Off},
+		{desc: "With a configured mode", mode: ReadOnly, expectedMode: ReadOnly},
+		{desc: "With an unknown configured mode", mode: "readonly", expectedMode: Drain},
+		{desc: "With a read-only flag file", flagFile: flag("read_only\n"), expectedMode: ReadOnly},
+		{desc: "With a drain flag file", flagFile: flag("drain\n"), expectedMode: Drain},
+		{desc: "With an empty flag file", flagFile: flag(""), expectedMode: Drain},
+		{desc: "With a flag file less restrictive than the config", mode: Drain, flagFile: flag("read_only"), expectedMode: Drain},
+		{desc: "With a flag file more restrictive than the config", mode: ReadOnly, flagFile: flag("drain"), expectedMode: Drain},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			os.Remove(flagFile)
+			if tc.flagFile != nil {
+				require.NoError(t, ioutil.WriteFile(flagFile, []byte(*tc.flagFile), 0644))
+			}
+
+			require.Equal(t, tc.expectedMode, Mode(&config.MaintenanceConfig{Mode: tc.mode, FlagFile: flagFile}))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		desc             string
+		mode             string
+		commandType      commandargs.CommandType
+		sshArgs          []string
+		expectedMessage  string
+		expectedExitCode int
+	}{
+		{desc: "Reads in read-only mode", mode: ReadOnly, commandType: commandargs.UploadPack},
+		{desc: "LFS downloads in read-only mode", mode: ReadOnly, commandType: commandargs.LfsAuthenticate, sshArgs: []string{"git-lfs-authenticate", "group/repo", "download"}},
+		{
+			desc:             "Pushes in read-only mode",
+			mode:             ReadOnly,
+			commandType:      commandargs.ReceivePack,
+			expectedMessage:  readOnlyMessage + "\nSee status.example.com",
+			expectedExitCode: ReadOnlyExitCode,
+		},
+		{
+			desc:             "LFS uploads in read-only mode",
+			mode:             ReadOnly,
+			commandType:      commandargs.LfsTransfer,
+			sshArgs:          []string{"git-lfs-transfer", "group/repo", "upload"},
+			expectedMessage:  readOnlyMessage + "\nSee status.example.com",
+			expectedExitCode: ReadOnlyExitCode,
+		},
+		{
+			desc:             "Reads in drain mode",
+			mode:             Drain,
+			commandType:      commandargs.Discover,
+			expectedMessage:  drainMessage + "\nSee status.example.com",
+			expectedExitCode: DrainExitCode,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			cfg := &config.Config{Maintenance: config.MaintenanceConfig{Mode: tc.mode, Message: "See status.example.com"}}
+			args := &commandargs.CommandArgs{CommandType: tc.commandType, SshArgs: tc.sshArgs}
+
+			err := Check(cfg, args)
+			if tc.expectedMessage == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.EqualError(t, err, tc.expectedMessage)
+			require.Equal(t, tc.expectedExitCode, err.(*Error).ExitCode())
+		})
+	}
+}
+
+func flag(content string) *string {
+	return &content
+}
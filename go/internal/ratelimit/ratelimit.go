@@ -0,0 +1,209 @@
+// Package ratelimit limits how many Git sessions every key or user runs at
+// once and per minute. The counters live in files shared by all the
+// gitlab-shell processes of the host.
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/lockfile"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+const (
+	window       = time.Minute
+	pollInterval = 100 * time.Millisecond
+)
+
+var (
+	ErrTooManyConcurrent = console.NewError("Too many concurrent Git operations, please try again later")
+	ErrTooManyPerMinute  = console.NewError("Too many Git operations per minute, please try again later")
+
+	// timeNow is overridden in tests
+	timeNow = time.Now
+)
+
+// Limiter enforces the limits of a RateLimitConfig
+type Limiter struct {
+	dir           string
+	maxConcurrent int
+	maxPerMinute  int
+	wait          time.Duration
+}
+
+func NewLimiter(cfg *config.RateLimitConfig) *Limiter {
+	return &Limiter{
+		dir:           cfg.Dir,
+		maxConcurrent: cfg.MaxConcurrent,
+		maxPerMinute:  cfg.MaxPerMinute,
+		wait:          time.Duration(cfg.WaitSeconds) * time.Second,
+	}
+}
+
+// Check admits the session described by args, or refuses it once it waited
+// for as long as configured. Sessions of unknown users and commands other
+// than Git operations are not limited.
+func Check(cfg *config.Config, args *commandargs.CommandArgs) error {
+	who := identity(args)
+	if who == "" || !args.CommandType.IsGitOperation() {
+		return nil
+	}
+
+	err := NewLimiter(&cfg.RateLimit).Admit(who)
+	if err == ErrTooManyConcurrent || err == ErrTooManyPerMinute {
+		logger.Warn("Rate limited session", map[string]interface{}{"command": args.SshCommand, "who": who, "error": err.Error()})
+	} else if err != nil {
+		// Broken limits must not lock anyone out
+		logger.Warn("Failed to apply rate limits", map[string]interface{}{"who": who, "error": err.Error()})
+		return nil
+	}
+
+	return err
+}
+
+// Admit counts a new session of who, holding one of its concurrency slots
+// until the process exits.
+func (l *Limiter) Admit(who string) error {
+	if l.maxConcurrent <= 0 && l.maxPerMinute <= 0 {
+		return nil
+	}
+
+	deadline := timeNow().Add(l.wait)
+	base := filepath.Join(l.dir, digest(who))
+
+	if err := os.MkdirAll(l.dir, 0700); err != nil {
+		return err
+	}
+
+	var slot *lockfile.LockFile
+	if l.maxConcurrent > 0 {
+		var err error
+		if slot, err = l.acquireSlot(base, deadline); err != nil {
+			return err
+		}
+	}
+
+	// Only sessions that got a slot count as started
+	if l.maxPerMinute > 0 {
+		if err := l.recordStart(base+".rate", deadline); err != nil {
+			if slot != nil {
+				slot.Unlock()
+			}
+
+			return err
+		}
+	}
+
+	if slot != nil {
+		slot.HoldUntilExit()
+	}
+
+	return nil
+}
+
+// recordStart adds the current session to the starts of the last minute kept
+// in path, waiting for the oldest one to expire when there are too many.
+func (l *Limiter) recordStart(path string, deadline time.Time) error {
+	for {
+		retryAt, err := l.tryRecordStart(path)
+		if err != nil || retryAt.IsZero() {
+			return err
+		}
+
+		if retryAt.After(deadline) {
+			return ErrTooManyPerMinute
+		}
+
+		time.Sleep(retryAt.Sub(timeNow()))
+	}
+}
+
+// tryRecordStart returns when to try again if the limit is reached
+func (l *Limiter) tryRecordStart(path string) (time.Time, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return time.Time{}, err
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	now := timeNow()
+	var starts []string
+	for _, line := range strings.Fields(string(data)) {
+		start, err := strconv.ParseInt(line, 10, 64)
+		if err == nil && now.Sub(time.Unix(0, start)) < window {
+			starts = append(starts, line)
+		}
+	}
+
+	if len(starts) >= l.maxPerMinute {
+		oldest, _ := strconv.ParseInt(starts[len(starts)-l.maxPerMinute], 10, 64)
+		return time.Unix(0, oldest).Add(window), nil
+	}
+
+	starts = append(starts, strconv.FormatInt(now.UnixNano(), 10))
+
+	if err := file.Truncate(0); err != nil {
+		return time.Time{}, err
+	}
+
+	_, err = file.WriteAt([]byte(strings.Join(starts, "\n")+"\n"), 0)
+
+	return time.Time{}, err
+}
+
+// acquireSlot locks one of the maxConcurrent slot files of base, waiting
+// for one to be released until deadline
+func (l *Limiter) acquireSlot(base string, deadline time.Time) (*lockfile.LockFile, error) {
+	for {
+		slot, err := lockfile.AcquireSlot(base+".slot-", l.maxConcurrent)
+		if err != nil || slot != nil {
+			return slot, err
+		}
+
+		if timeNow().Add(pollInterval).After(deadline) {
+			return nil, ErrTooManyConcurrent
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// identity names the key or user the session belongs to
+func identity(args *commandargs.CommandArgs) string {
+	switch {
+	case args.GitlabKeyId != "":
+		return "key-" + args.GitlabKeyId
+	case args.GitlabUserId != "":
+		return "user-" + args.GitlabUserId
+	case args.GitlabUsername != "":
+		return "username-" + args.GitlabUsername
+	}
+
+	return ""
+}
+
+func digest(who string) string {
+	sum := sha256.Sum256([]byte(who))
+
+	return hex.EncodeToString(sum[:])
+}
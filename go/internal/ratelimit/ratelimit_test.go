@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/lockfile"
+)
+
+func TestMaxConcurrent(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	limiter := NewLimiter(&config.RateLimitConfig{Dir: dir, MaxConcurrent: 2})
+
+	require.NoError(t, limiter.Admit("key-1"))
+	require.NoError(t, limiter.Admit("key-1"))
+	require.Equal(t, ErrTooManyConcurrent, limiter.Admit("key-1"))
+	require.NoError(t, limiter.Admit("key-2"))
+
+	lockfile.ReleaseHeld()
+	require.NoError(t, limiter.Admit("key-1"))
+}
+
+func TestMaxConcurrentWaits(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	// Held by another session of the key
+	slot, err := lockfile.TryLock(filepath.Join(dir, digest("key-1")) + ".slot-0")
+	require.NoError(t, err)
+	require.NotNil(t, slot)
+
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		time.Sleep(200 * time.Millisecond)
+		slot.Unlock()
+	}()
+
+	limiter := NewLimiter(&config.RateLimitConfig{Dir: dir, MaxConcurrent: 1, WaitSeconds: 2})
+
+	start := time.Now()
+	require.NoError(t, NewLimiter(&config.RateLimitConfig{Dir: dir, MaxConcurrent: 1}).Admit("key-2"))
+	require.NoError(t, limiter.Admit("key-1"))
+	require.True(t, time.Since(start) < 2*time.Second)
+
+	<-released
+}
+
+func TestRejectedSessionsDontCountAsStarted(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	limiter := NewLimiter(&config.RateLimitConfig{Dir: dir, MaxConcurrent: 1, MaxPerMinute: 2})
+
+	require.NoError(t, limiter.Admit("key-1"))
+	require.Equal(t, ErrTooManyConcurrent, limiter.Admit("key-1"))
+	require.Equal(t, ErrTooManyConcurrent, limiter.Admit("key-1"))
+
+	lockfile.ReleaseHeld()
+	require.NoError(t, limiter.Admit("key-1"))
+}
+
+func TestMaxPerMinute(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	now := time.Unix(1600000000, 0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	limiter := NewLimiter(&config.RateLimitConfig{Dir: dir, MaxPerMinute: 2})
+
+	require.NoError(t, limiter.Admit("user-1"))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, limiter.Admit("user-1"))
+	require.Equal(t, ErrTooManyPerMinute, limiter.Admit("user-1"))
+	require.NoError(t, limiter.Admit("user-2"))
+
+	// The first session is over a minute old
+	now = now.Add(31 * time.Second)
+	require.NoError(t, limiter.Admit("user-1"))
+	require.Equal(t, ErrTooManyPerMinute, limiter.Admit("user-1"))
+}
+
+func TestCheck(t *testing.T) {
+	dir, cleanup := setup(t)
+	defer cleanup()
+
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{Dir: dir, MaxConcurrent: 1}}
+
+	testCases := []struct {
+		desc          string
+		args          *commandargs.CommandArgs
+		expectedError error
+	}{
+		{
+			desc: "A first Git operation",
+			args: &commandargs.CommandArgs{GitlabKeyId: "1", CommandType: commandargs.UploadPack},
+		},
+		{
+			desc:          "A second Git operation of the same key",
+			args:          &commandargs.CommandArgs{GitlabKeyId: "1", CommandType: commandargs.ReceivePack},
+			expectedError: ErrTooManyConcurrent,
+		},
+		{
+			desc: "A Git operation of a user with the same id",
+			args: &commandargs.CommandArgs{GitlabUserId: "1", CommandType: commandargs.UploadPack},
+		},
+		{
+			desc: "Another command of the same key",
+			args: &commandargs.CommandArgs{GitlabKeyId: "1", CommandType: commandargs.Discover},
+		},
+		{
+			desc: "A Git operation of an unknown user",
+			args: &commandargs.CommandArgs{CommandType: commandargs.UploadPack},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.expectedError, Check(cfg, tc.args))
+		})
+	}
+}
+
+func TestRefusalsAreShownToTheUser(t *testing.T) {
+	out := &bytes.Buffer{}
+	console.DisplayError(ErrTooManyConcurrent, out)
+	console.DisplayError(ErrTooManyPerMinute, out)
+
+	require.Equal(t, "> GitLab: Too many concurrent Git operations, please try again later\n"+
+		"> GitLab: Too many Git operations per minute, please try again later\n", out.String())
+}
+
+func TestCheckWithBrokenDir(t *testing.T) {
+	file, err := ioutil.TempFile("", "ratelimit")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{Dir: file.Name(), MaxConcurrent: 1}}
+	args := &commandargs.CommandArgs{GitlabKeyId: "1", CommandType: commandargs.UploadPack}
+
+	require.NoError(t, Check(cfg, args))
+}
+
+func setup(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ratelimit")
+	require.NoError(t, err)
+
+	return dir, func() {
+		lockfile.ReleaseHeld()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,148 @@
+// Package sshaccess enforces the ssh_access section of config.yml, which
+// restricts the addresses SSH clients may connect from.
+package sshaccess
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/logger"
+)
+
+type rules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// Policy holds the parsed allow and deny lists
+type Policy struct {
+	global   *rules
+	commands map[commandargs.CommandType]*rules
+}
+
+func NewPolicy(cfg *config.SshAccessConfig) (*Policy, error) {
+	global, err := parseRules(&cfg.IpRulesConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{global: global, commands: make(map[commandargs.CommandType]*rules)}
+
+	for commandType, commandConfig := range cfg.Commands {
+		commandRules, err := parseRules(&commandConfig)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", commandType, err)
+		}
+
+		policy.commands[commandargs.CommandType(commandType)] = commandRules
+	}
+
+	return policy, nil
+}
+
+// Allowed tells whether a client connecting from remoteIp may run
+// commandType. An unknown address only passes rules without an allow list.
+func (p *Policy) Allowed(remoteIp string, commandType commandargs.CommandType) bool {
+	ip := net.ParseIP(remoteIp)
+
+	if !p.global.allowed(ip) {
+		return false
+	}
+
+	if commandRules, ok := p.commands[commandType]; ok {
+		return commandRules.allowed(ip)
+	}
+
+	return true
+}
+
+// Check enforces the policy of cfg on the connection described by args. The
+// error is a console.Error, meant to be shown to the user.
+func Check(cfg *config.Config, args *commandargs.CommandArgs) error {
+	remoteIp := args.SshConnection.RemoteIp
+
+	policy, err := NewPolicy(&cfg.SshAccess)
+	if err != nil {
+		// Fail closed, a broken policy must not open access
+		logger.Warn("Invalid ssh_access configuration", map[string]interface{}{"error": err.Error()})
+		return console.NewError("SSH access is misconfigured, please contact your administrator")
+	}
+
+	if policy.Allowed(remoteIp, args.CommandType) {
+		return nil
+	}
+
+	logger.Warn("SSH access denied by ssh_access", map[string]interface{}{"remote_ip": remoteIp, "command": string(args.CommandType)})
+
+	if remoteIp == "" {
+		return console.NewError("SSH access from an unknown address is not allowed")
+	}
+
+	return console.NewError(fmt.Sprintf("SSH access from %s is not allowed", remoteIp))
+}
+
+func parseRules(cfg *config.IpRulesConfig) (*rules, error) {
+	allow, err := parseNetworks(cfg.Allow)
+	if err != nil {
+		return nil, err
+	}
+
+	deny, err := parseNetworks(cfg.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rules{allow: allow, deny: deny}, nil
+}
+
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, value := range values {
+		cidr := value
+
+		// A single address is a network of its own
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address range %q", value)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func (r *rules) allowed(ip net.IP) bool {
+	if ip == nil {
+		return len(r.allow) == 0
+	}
+
+	if contains(r.deny, ip) {
+		return false
+	}
+
+	return len(r.allow) == 0 || contains(r.allow, ip)
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
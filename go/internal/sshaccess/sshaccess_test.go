@@ -0,0 +1,90 @@
+package sshaccess
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/command/commandargs"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/console"
+)
+
+func TestAllowed(t *testing.T) {
+	cfg := &config.SshAccessConfig{
+		IpRulesConfig: config.IpRulesConfig{
+			Allow: []string{"10.0.0.0/8", "2001:db8::/32", "192.168.1.10"},
+			Deny:  []string{"10.1.0.0/16"},
+		},
+		Commands: map[string]config.IpRulesConfig{
+			"git-receive-pack": {Allow: []string{"10.8.0.0/16"}},
+		},
+	}
+
+	policy, err := NewPolicy(cfg)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		remoteIp    string
+		commandType commandargs.CommandType
+		allowed     bool
+	}{
+		{remoteIp: "10.2.3.4", commandType: commandargs.UploadPack, allowed: true},
+		{remoteIp: "192.168.1.10", commandType: commandargs.UploadPack, allowed: true},
+		{remoteIp: "2001:db8::1", commandType: commandargs.Discover, allowed: true},
+		{remoteIp: "10.1.2.3", commandType: commandargs.UploadPack, allowed: false},
+		{remoteIp: "172.16.0.1", commandType: commandargs.UploadPack, allowed: false},
+		{remoteIp: "192.168.1.11", commandType: commandargs.UploadPack, allowed: false},
+		{remoteIp: "10.8.0.1", commandType: commandargs.ReceivePack, allowed: true},
+		{remoteIp: "10.2.3.4", commandType: commandargs.ReceivePack, allowed: false},
+		{remoteIp: "", commandType: commandargs.UploadPack, allowed: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.remoteIp+" "+string(tc.commandType), func(t *testing.T) {
+			require.Equal(t, tc.allowed, policy.Allowed(tc.remoteIp, tc.commandType))
+		})
+	}
+}
+
+func TestDenyOnly(t *testing.T) {
+	policy, err := NewPolicy(&config.SshAccessConfig{IpRulesConfig: config.IpRulesConfig{Deny: []string{"203.0.113.0/24"}}})
+	require.NoError(t, err)
+
+	require.False(t, policy.Allowed("203.0.113.7", commandargs.UploadPack))
+	require.True(t, policy.Allowed("198.51.100.7", commandargs.UploadPack))
+	require.True(t, policy.Allowed("", commandargs.UploadPack))
+}
+
+func TestCheck(t *testing.T) {
+	cfg := &config.Config{SshAccess: config.SshAccessConfig{IpRulesConfig: config.IpRulesConfig{Allow: []string{"10.0.0.0/8"}}}}
+
+	args := &commandargs.CommandArgs{CommandType: commandargs.UploadPack, SshConnection: commandargs.SshConnection{RemoteIp: "10.0.0.1"}}
+	require.NoError(t, Check(cfg, args))
+
+	args.SshConnection.RemoteIp = "192.168.1.10"
+	require.EqualError(t, Check(cfg, args), "SSH access from 192.168.1.10 is not allowed")
+
+	args.SshConnection.RemoteIp = ""
+	require.EqualError(t, Check(cfg, args), "SSH access from an unknown address is not allowed")
+}
+
+func TestCheckErrorIsShownToTheUser(t *testing.T) {
+	cfg := &config.Config{SshAccess: config.SshAccessConfig{IpRulesConfig: config.IpRulesConfig{Deny: []string{"192.168.1.0/24"}}}}
+	args := &commandargs.CommandArgs{CommandType: commandargs.UploadPack, SshConnection: commandargs.SshConnection{RemoteIp: "192.168.1.10"}}
+
+	out := &bytes.Buffer{}
+	console.DisplayError(Check(cfg, args), out)
+
+	require.Equal(t, "> GitLab: SSH access from 192.168.1.10 is not allowed\n", out.String())
+}
+
+func TestCheckWithInvalidConfig(t *testing.T) {
+	_, err := NewPolicy(&config.SshAccessConfig{Commands: map[string]config.IpRulesConfig{"git-upload-pack": {Deny: []string{"10.0.0.0/33"}}}})
+	require.EqualError(t, err, `git-upload-pack: invalid address range "10.0.0.0/33"`)
+
+	cfg := &config.Config{SshAccess: config.SshAccessConfig{IpRulesConfig: config.IpRulesConfig{Allow: []string{"corp"}}}}
+	args := &commandargs.CommandArgs{CommandType: commandargs.UploadPack, SshConnection: commandargs.SshConnection{RemoteIp: "10.0.0.1"}}
+	require.EqualError(t, Check(cfg, args), "SSH access is misconfigured, please contact your administrator")
+}
@@ -0,0 +1,109 @@
+package sshkey
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Certificate holds the fields of an OpenSSH certificate that identify it,
+// see PROTOCOL.certkeys in the OpenSSH sources.
+type Certificate struct {
+	Serial     uint64
+	KeyId      string
+	Principals []string
+	// SignatureKey is the blob of the CA key that signed the certificate
+	SignatureKey []byte
+}
+
+// Certificate parses the certificate part of a certificate key
+func (k *Key) Certificate() (*Certificate, error) {
+	algorithm, ok := certificateTypes[k.Type]
+	if !ok {
+		return nil, errors.New("Invalid key: not a certificate")
+	}
+
+	r := &blobReader{data: k.Blob}
+
+	if err := r.skip(2); err != nil { // type, nonce
+		return nil, err
+	}
+
+	if _, err := readPublicKey(r, algorithm); err != nil {
+		return nil, err
+	}
+
+	cert := &Certificate{}
+	var err error
+
+	if cert.Serial, err = r.readUint64(); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.readUint32(); err != nil { // user or host certificate
+		return nil, err
+	}
+
+	keyId, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+	cert.KeyId = string(keyId)
+
+	principals, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+
+	for pr := (&blobReader{data: principals}); len(pr.data) > 0; {
+		principal, err := pr.readString()
+		if err != nil {
+			return nil, err
+		}
+		cert.Principals = append(cert.Principals, string(principal))
+	}
+
+	// valid after, valid before
+	if _, err := r.readUint64(); err != nil {
+		return nil, err
+	}
+	if _, err := r.readUint64(); err != nil {
+		return nil, err
+	}
+
+	if err := r.skip(3); err != nil { // critical options, extensions, reserved
+		return nil, err
+	}
+
+	if cert.SignatureKey, err = r.readString(); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// CaFingerprint is the SHA256 fingerprint of the CA key
+func (c *Certificate) CaFingerprint() string {
+	return fingerprint(c.SignatureKey)
+}
+
+func (r *blobReader) readUint32() (uint32, error) {
+	if len(r.data) < 4 {
+		return 0, errTruncated
+	}
+
+	value := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+
+	return value, nil
+}
+
+func (r *blobReader) readUint64() (uint64, error) {
+	if len(r.data) < 8 {
+		return 0, errTruncated
+	}
+
+	value := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+
+	return value, nil
+}
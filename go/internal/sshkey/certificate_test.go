@@ -0,0 +1,41 @@
+package sshkey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// ssh-keygen -s ca -I alice@example.com -n alice,deploy -z 42 user.pub
+	aliceCertKey = "ssh-ed25519-cert-v01@openssh.com AAAAIHNzaC1lZDI1NTE5LWNlcnQtdjAxQG9wZW5zc2guY29tAAAAIEODRQdvA3QztrEItuzPhQepv7O9e7C4lNQNRMJ93TkVAAAAIJdt6osSXaXpwPqK8b5xpmIQTPISXwpgxOAODbL56F+TAAAAAAAAACoAAAABAAAAEWFsaWNlQGV4YW1wbGUuY29tAAAAEwAAAAVhbGljZQAAAAZkZXBsb3kAAAAAAAAAAP//////////AAAAAAAAAIIAAAAVcGVybWl0LVgxMS1mb3J3YXJkaW5nAAAAAAAAABdwZXJtaXQtYWdlbnQtZm9yd2FyZGluZwAAAAAAAAAWcGVybWl0LXBvcnQtZm9yd2FyZGluZwAAAAAAAAAKcGVybWl0LXB0eQAAAAAAAAAOcGVybWl0LXVzZXItcmMAAAAAAAAAAAAAADMAAAALc3NoLWVkMjU1MTkAAAAgQh4QP+vn+sj2IAtN0G7VByZhF9qzhG36rDfV2FeLJvkAAABTAAAAC3NzaC1lZDI1NTE5AAAAQBOK6wMEbtFJjaXlWBIK7SohxijEbVaAJqsF69c9EXIAVPtum4+PwuHaf+wqLHLiEHQ+qJG09dEumLBvfTspZA8= user"
+)
+
+func TestCertificate(t *testing.T) {
+	key, err := Parse(aliceCertKey)
+	require.NoError(t, err)
+
+	cert, err := key.Certificate()
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(42), cert.Serial)
+	require.Equal(t, "alice@example.com", cert.KeyId)
+	require.Equal(t, []string{"alice", "deploy"}, cert.Principals)
+	// ssh-keygen -L
+	require.Equal(t, "SHA256:c7Burg4wPUDe0zRHARpsGe9DWk81qXrdhaUY4UZDJnU", cert.CaFingerprint())
+}
+
+func TestCertificateFailures(t *testing.T) {
+	key, err := Parse(ed25519Key)
+	require.NoError(t, err)
+
+	_, err = key.Certificate()
+	require.EqualError(t, err, "Invalid key: not a certificate")
+
+	key, err = Parse(aliceCertKey)
+	require.NoError(t, err)
+	key.Blob = key.Blob[:len(key.Blob)-200]
+
+	_, err = key.Certificate()
+	require.EqualError(t, err, "Invalid key: truncated key blob")
+}
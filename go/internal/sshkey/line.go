@@ -0,0 +1,34 @@
+package sshkey
+
+import (
+	"errors"
+	"strings"
+)
+
+// SplitOptions splits a line of authorized_keys into its options, if any, and
+// the key that follows them.
+func SplitOptions(line string) (string, string, error) {
+	line = strings.TrimSpace(line)
+
+	if fields := strings.Fields(line); len(fields) > 0 && IsKnownType(fields[0]) {
+		return "", line, nil
+	}
+
+	inQuotes := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && inQuotes && i+1 < len(line):
+			i++
+		case line[i] == '"':
+			inQuotes = !inQuotes
+		case (line[i] == ' ' || line[i] == '\t') && !inQuotes:
+			return line[:i], strings.TrimSpace(line[i:]), nil
+		}
+	}
+
+	if inQuotes {
+		return "", "", errors.New("Invalid options: unterminated quoted string")
+	}
+
+	return line, "", nil
+}
@@ -0,0 +1,39 @@
+package sshkey
+
+import (
+	"fmt"
+)
+
+// Policy restricts the keys gitlab-keys writes to authorized_keys
+type Policy struct {
+	// AllowedTypes lists key types, or the key types of allowed certificates.
+	// Every type is allowed when it is empty.
+	AllowedTypes []string
+	MinRsaBits   int
+}
+
+func (p *Policy) Check(key *Key) error {
+	if !p.allows(key) {
+		return fmt.Errorf("Key type %s is not allowed", key.Type)
+	}
+
+	if key.Algorithm() == TypeRsa && key.Bits < p.MinRsaBits {
+		return fmt.Errorf("RSA keys must have at least %d bits, this one has %d", p.MinRsaBits, key.Bits)
+	}
+
+	return nil
+}
+
+func (p *Policy) allows(key *Key) bool {
+	if len(p.AllowedTypes) == 0 {
+		return true
+	}
+
+	for _, allowedType := range p.AllowedTypes {
+		if allowedType == key.Type || allowedType == key.Algorithm() {
+			return true
+		}
+	}
+
+	return false
+}
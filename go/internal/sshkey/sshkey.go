@@ -0,0 +1,299 @@
+package sshkey
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	TypeRsa              = "ssh-rsa"
+	TypeDsa              = "ssh-dss"
+	TypeEcdsaP256        = "ecdsa-sha2-nistp256"
+	TypeEcdsaP384        = "ecdsa-sha2-nistp384"
+	TypeEcdsaP521        = "ecdsa-sha2-nistp521"
+	TypeEd25519          = "ssh-ed25519"
+	TypeSkEcdsaP256      = "sk-ecdsa-sha2-nistp256@openssh.com"
+	TypeSkEd25519        = "sk-ssh-ed25519@openssh.com"
+	TypeRsaCert          = "ssh-rsa-cert-v01@openssh.com"
+	TypeDsaCert          = "ssh-dss-cert-v01@openssh.com"
+	TypeEcdsaP256Cert    = "ecdsa-sha2-nistp256-cert-v01@openssh.com"
+	TypeEcdsaP384Cert    = "ecdsa-sha2-nistp384-cert-v01@openssh.com"
+	TypeEcdsaP521Cert    = "ecdsa-sha2-nistp521-cert-v01@openssh.com"
+	TypeEd25519Cert      = "ssh-ed25519-cert-v01@openssh.com"
+	TypeSkEcdsaP256Cert  = "sk-ecdsa-sha2-nistp256-cert-v01@openssh.com"
+	TypeSkEd25519Cert    = "sk-ssh-ed25519-cert-v01@openssh.com"
+	ed25519PublicKeySize = 32
+
+	FingerprintPrefix = "SHA256:"
+)
+
+var (
+	// certificateTypes maps certificate types to the type of their key
+	certificateTypes = map[string]string{
+		TypeRsaCert:         TypeRsa,
+		TypeDsaCert:         TypeDsa,
+		TypeEcdsaP256Cert:   TypeEcdsaP256,
+		TypeEcdsaP384Cert:   TypeEcdsaP384,
+		TypeEcdsaP521Cert:   TypeEcdsaP521,
+		TypeEd25519Cert:     TypeEd25519,
+		TypeSkEcdsaP256Cert: TypeSkEcdsaP256,
+		TypeSkEd25519Cert:   TypeSkEd25519,
+	}
+
+	keyTypes = map[string]bool{
+		TypeRsa:         true,
+		TypeDsa:         true,
+		TypeEcdsaP256:   true,
+		TypeEcdsaP384:   true,
+		TypeEcdsaP521:   true,
+		TypeEd25519:     true,
+		TypeSkEcdsaP256: true,
+		TypeSkEd25519:   true,
+	}
+
+	ecdsaCurves = map[string]struct {
+		name string
+		bits int
+	}{
+		TypeEcdsaP256:   {"nistp256", 256},
+		TypeEcdsaP384:   {"nistp384", 384},
+		TypeEcdsaP521:   {"nistp521", 521},
+		TypeSkEcdsaP256: {"nistp256", 256},
+	}
+
+	errTruncated = errors.New("Invalid key: truncated key blob")
+)
+
+// Key is an OpenSSH public key, as found in authorized_keys
+type Key struct {
+	Type    string
+	Blob    []byte
+	Comment string
+	// Bits is the size of the key, or of the key a certificate is for
+	Bits int
+}
+
+// IsKnownType tells whether keyType is an OpenSSH key or certificate type
+func IsKnownType(keyType string) bool {
+	_, isCertificate := certificateTypes[keyType]
+
+	return keyTypes[keyType] || isCertificate
+}
+
+// Parse parses a public key in the `type base64-blob [comment]` format,
+// making sure the blob holds a key of the given type.
+func Parse(publicKey string) (*Key, error) {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return nil, errors.New("Invalid key: expected a key type followed by a base64 key blob")
+	}
+
+	key := &Key{Type: fields[0], Comment: strings.Join(fields[2:], " ")}
+	if !IsKnownType(key.Type) {
+		return nil, fmt.Errorf("Invalid key: unsupported key type %s", key.Type)
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errors.New("Invalid key: key blob is not valid base64")
+	}
+	key.Blob = blob
+
+	if key.Bits, err = parseBlob(key.Type, blob); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Algorithm is the type of the key, which for certificates is the type of
+// the key they certify.
+func (k *Key) Algorithm() string {
+	if keyType, ok := certificateTypes[k.Type]; ok {
+		return keyType
+	}
+
+	return k.Type
+}
+
+func (k *Key) IsCertificate() bool {
+	_, ok := certificateTypes[k.Type]
+
+	return ok
+}
+
+// Fingerprint is the SHA256 fingerprint of the key, as sshd passes it to
+// AuthorizedKeysCommand for %f.
+func (k *Key) Fingerprint() string {
+	return fingerprint(k.Blob)
+}
+
+func (k *Key) String() string {
+	key := k.Type + " " + base64.StdEncoding.EncodeToString(k.Blob)
+	if k.Comment != "" {
+		key += " " + k.Comment
+	}
+
+	return key
+}
+
+func parseBlob(keyType string, blob []byte) (int, error) {
+	r := &blobReader{data: blob}
+
+	name, err := r.readString()
+	if err != nil {
+		return 0, err
+	}
+
+	if string(name) != keyType {
+		return 0, fmt.Errorf("Invalid key: key blob holds a %s key, not %s", name, keyType)
+	}
+
+	algorithm, isCertificate := certificateTypes[keyType]
+	if isCertificate {
+		if err := r.skip(1); err != nil { // nonce
+			return 0, err
+		}
+	} else {
+		algorithm = keyType
+	}
+
+	bits, err := readPublicKey(r, algorithm)
+	if err != nil {
+		return 0, err
+	}
+
+	// Certificates go on with serial, principals, validity, signature...
+	if isCertificate && len(r.data) == 0 {
+		return 0, errTruncated
+	} else if !isCertificate && len(r.data) > 0 {
+		return 0, errors.New("Invalid key: trailing data after the key")
+	}
+
+	return bits, nil
+}
+
+func readPublicKey(r *blobReader, algorithm string) (int, error) {
+	switch algorithm {
+	case TypeRsa:
+		if err := r.skip(1); err != nil { // e
+			return 0, err
+		}
+
+		n, err := r.readString()
+		if err != nil {
+			return 0, err
+		}
+
+		return new(big.Int).SetBytes(n).BitLen(), nil
+	case TypeDsa:
+		p, err := r.readString()
+		if err != nil {
+			return 0, err
+		}
+
+		if err := r.skip(3); err != nil { // q, g, y
+			return 0, err
+		}
+
+		return new(big.Int).SetBytes(p).BitLen(), nil
+	case TypeEd25519:
+		return readEd25519(r)
+	case TypeSkEd25519:
+		bits, err := readEd25519(r)
+		if err != nil {
+			return 0, err
+		}
+
+		// Security keys also carry the application they are registered for
+		return bits, r.skip(1)
+	case TypeSkEcdsaP256:
+		bits, err := readEcdsa(r, algorithm)
+		if err != nil {
+			return 0, err
+		}
+
+		return bits, r.skip(1)
+	default:
+		return readEcdsa(r, algorithm)
+	}
+}
+
+func readEd25519(r *blobReader) (int, error) {
+	publicKey, err := r.readString()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(publicKey) != ed25519PublicKeySize {
+		return 0, errors.New("Invalid key: bad ed25519 public key size")
+	}
+
+	return 256, nil
+}
+
+func readEcdsa(r *blobReader, algorithm string) (int, error) {
+	curve := ecdsaCurves[algorithm]
+
+	name, err := r.readString()
+	if err != nil {
+		return 0, err
+	}
+
+	if string(name) != curve.name {
+		return 0, fmt.Errorf("Invalid key: curve %s doesn't match the key type", name)
+	}
+
+	point, err := r.readString()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(point) == 0 {
+		return 0, errors.New("Invalid key: empty ecdsa public key")
+	}
+
+	return curve.bits, nil
+}
+
+func fingerprint(blob []byte) string {
+	digest := sha256.Sum256(blob)
+
+	return FingerprintPrefix + base64.RawStdEncoding.EncodeToString(digest[:])
+}
+
+type blobReader struct {
+	data []byte
+}
+
+// readString reads a length-prefixed string as defined by RFC 4251
+func (r *blobReader) readString() ([]byte, error) {
+	if len(r.data) < 4 {
+		return nil, errTruncated
+	}
+
+	length := binary.BigEndian.Uint32(r.data)
+	if uint64(len(r.data)-4) < uint64(length) {
+		return nil, errTruncated
+	}
+
+	value := r.data[4 : 4+length]
+	r.data = r.data[4+length:]
+
+	return value, nil
+}
+
+func (r *blobReader) skip(count int) error {
+	for i := 0; i < count; i++ {
+		if _, err := r.readString(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package sshkey
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	rsa1024Key = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQCrO2P2yhJE8y7ZpZGRwjmdSWy1oLNL4AfafELabx68b6g5SrGv2Xf+Gct4RrUlGG8zILV8ZO4/yyxWcCd0Vj6miQg8iiVnsf2xJV3zWM+dZ7Ofw3caXSe+G9sn87KjMxMT3efwkDWDsaGyF7mmbqg58vNX+2pjni0ZsDsKcOv5AQ== rsa1024"
+	rsa2048Key = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQDoPgC/MYIvycBYq3cXD7BgTLaIDcDzWKinG9eD0vUVHDOz9r+Ueg166wmjebS9gBqNhsbF4g/xl+FJlQiiSc4kHKw3p2G2CQGO7rlZRrY8kkjGAIqGbzCUSXtFesLasaREo53BRUF0azaFsVTVTvyvJWxDNf3TOay9VCnUMOWWT5beLLXip1dfdHv5qCMipEdS5SWihi5c4kRv/pltDLtyjd9OCEdlgEf3N4SIn08rJ8nDuenuB8e3lrQ3SmbvzRLkru7Y8DKKTeHfCZrw/yEMqHF1V8GRATh9Bu8rnjEtg4cB5iDyegsgyBblGLP80jbHthTdIqdkMbVVTiGzg0Vl rsa2048"
+	ed25519Key = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAhAg84Lrg+DZY6mkZTxo7xZECLzyfa//7+2Q5/HJ5dz ed"
+	ecdsaKey   = "ecdsa-sha2-nistp384 AAAAE2VjZHNhLXNoYTItbmlzdHAzODQAAAAIbmlzdHAzODQAAABhBI0n8f43Y4WBgv38j+D75SCpOmdqCIjTSKcL6BUj9nNKGfUA87R7oOpj6kS1a6x/jniBoK1vMM506KVEJq7VWt3u4ygL+kHnQl5plJImtcbQV1atRbHr07eG234i3yUMWw== ec384"
+	certKey    = "ssh-ed25519-cert-v01@openssh.com AAAAIHNzaC1lZDI1NTE5LWNlcnQtdjAxQG9wZW5zc2guY29tAAAAIP1tL6U4pObJg/dDhXaBQFmwL4P2aDSX6E/ayppnRuiYAAAAIAhAg84Lrg+DZY6mkZTxo7xZECLzyfa//7+2Q5/HJ5dzAAAAAAAAAAAAAAABAAAAAmlkAAAABwAAAANnaXQAAAAAAAAAAP//////////AAAAAAAAAIIAAAAVcGVybWl0LVgxMS1mb3J3YXJkaW5nAAAAAAAAABdwZXJtaXQtYWdlbnQtZm9yd2FyZGluZwAAAAAAAAAWcGVybWl0LXBvcnQtZm9yd2FyZGluZwAAAAAAAAAKcGVybWl0LXB0eQAAAAAAAAAOcGVybWl0LXVzZXItcmMAAAAAAAAAAAAAADMAAAALc3NoLWVkMjU1MTkAAAAgklXPcKTrVgOSegXrmjhEiZbHSbfsDTdPV+hzfqsT52gAAABTAAAAC3NzaC1lZDI1NTE5AAAAQGHd2ofZet/2IN8UiZikCo/k48lf4AKqu09DqVR1iQDoJlREaB+OdPR4Ivv+LJHE0rRv1DB03JJ8HNw6qMb9owQ= ed"
+)
+
+// blob builds a key blob out of length-prefixed strings
+func blob(values ...string) string {
+	var data []byte
+	for _, value := range values {
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(value)))
+		data = append(append(data, length...), value...)
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		key           string
+		expectedType  string
+		expectedAlgo  string
+		expectedBits  int
+		isCertificate bool
+	}{
+		{desc: "RSA 1024", key: rsa1024Key, expectedType: TypeRsa, expectedAlgo: TypeRsa, expectedBits: 1024},
+		{desc: "RSA 2048", key: rsa2048Key, expectedType: TypeRsa, expectedAlgo: TypeRsa, expectedBits: 2048},
+		{desc: "Ed25519", key: ed25519Key, expectedType: TypeEd25519, expectedAlgo: TypeEd25519, expectedBits: 256},
+		{desc: "ECDSA", key: ecdsaKey, expectedType: TypeEcdsaP384, expectedAlgo: TypeEcdsaP384, expectedBits: 384},
+		{desc: "Certificate", key: certKey, expectedType: TypeEd25519Cert, expectedAlgo: TypeEd25519, expectedBits: 256, isCertificate: true},
+		{
+			desc:         "FIDO Ed25519",
+			key:          TypeSkEd25519 + " " + blob(TypeSkEd25519, strings.Repeat("k", 32), "ssh:"),
+			expectedType: TypeSkEd25519, expectedAlgo: TypeSkEd25519, expectedBits: 256,
+		},
+		{
+			desc:         "FIDO ECDSA",
+			key:          TypeSkEcdsaP256 + " " + blob(TypeSkEcdsaP256, "nistp256", strings.Repeat("q", 65), "ssh:"),
+			expectedType: TypeSkEcdsaP256, expectedAlgo: TypeSkEcdsaP256, expectedBits: 256,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			key, err := Parse(tc.key)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expectedType, key.Type)
+			require.Equal(t, tc.expectedAlgo, key.Algorithm())
+			require.Equal(t, tc.expectedBits, key.Bits)
+			require.Equal(t, tc.isCertificate, key.IsCertificate())
+			require.Equal(t, tc.key, key.String())
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	key, err := Parse(ed25519Key)
+	require.NoError(t, err)
+
+	// ssh-keygen -l -E sha256
+	require.Equal(t, "SHA256:noXBB6xNCj6nsadR0HGFdACSRMSdHOl62fCbdoFJoxU", key.Fingerprint())
+}
+
+func TestParseFailures(t *testing.T) {
+	testCases := []struct {
+		desc          string
+		key           string
+		expectedError string
+	}{
+		{
+			desc:          "Without a blob",
+			key:           "ssh-rsa",
+			expectedError: "Invalid key: expected a key type followed by a base64 key blob",
+		},
+		{
+			desc:          "With an unknown type",
+			key:           "ssh-foo AAAA",
+			expectedError: "Invalid key: unsupported key type ssh-foo",
+		},
+		{
+			desc:          "With invalid base64",
+			key:           "ssh-rsa AAA!",
+			expectedError: "Invalid key: key blob is not valid base64",
+		},
+		{
+			desc:          "With a mismatching type",
+			key:           "ssh-rsa " + strings.Fields(ed25519Key)[1],
+			expectedError: "Invalid key: key blob holds a ssh-ed25519 key, not ssh-rsa",
+		},
+		{
+			desc:          "With a truncated blob",
+			key:           "ssh-rsa " + strings.Fields(rsa2048Key)[1][:100],
+			expectedError: "Invalid key: truncated key blob",
+		},
+		{
+			desc:          "With trailing data",
+			key:           TypeEd25519 + " " + blob(TypeEd25519, strings.Repeat("k", 32), "extra"),
+			expectedError: "Invalid key: trailing data after the key",
+		},
+		{
+			desc:          "With a bad ed25519 key",
+			key:           TypeEd25519 + " " + blob(TypeEd25519, "short"),
+			expectedError: "Invalid key: bad ed25519 public key size",
+		},
+		{
+			desc:          "With a mismatching curve",
+			key:           TypeEcdsaP256 + " " + blob(TypeEcdsaP256, "nistp384", "point"),
+			expectedError: "Invalid key: curve nistp384 doesn't match the key type",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := Parse(tc.key)
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	rsa1024, err := Parse(rsa1024Key)
+	require.NoError(t, err)
+	rsa2048, err := Parse(rsa2048Key)
+	require.NoError(t, err)
+	cert, err := Parse(certKey)
+	require.NoError(t, err)
+
+	policy := &Policy{}
+	require.NoError(t, policy.Check(rsa1024))
+
+	policy = &Policy{AllowedTypes: []string{TypeRsa, TypeEd25519}, MinRsaBits: 2048}
+	require.NoError(t, policy.Check(rsa2048))
+	require.NoError(t, policy.Check(cert))
+	require.EqualError(t, policy.Check(rsa1024), "RSA keys must have at least 2048 bits, this one has 1024")
+
+	policy = &Policy{AllowedTypes: []string{TypeRsa}}
+	require.EqualError(t, policy.Check(cert), "Key type ssh-ed25519-cert-v01@openssh.com is not allowed")
+}
+
+func TestSplitOptions(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		line            string
+		expectedOptions string
+		expectedKey     string
+	}{
+		{
+			desc:        "Without options",
+			line:        ed25519Key,
+			expectedKey: ed25519Key,
+		},
+		{
+			desc:            "With quoted options",
+			line:            `command="/bin/gitlab-shell key-1",from="10.0.0.1, \"x\"",no-pty ` + ed25519Key,
+			expectedOptions: `command="/bin/gitlab-shell key-1",from="10.0.0.1, \"x\"",no-pty`,
+			expectedKey:     ed25519Key,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			options, key, err := SplitOptions(tc.line)
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expectedOptions, options)
+			require.Equal(t, tc.expectedKey, key)
+		})
+	}
+
+	_, _, err := SplitOptions(`command="/bin/gitlab-shell ` + ed25519Key)
+	require.EqualError(t, err, "Invalid options: unterminated quoted string")
+}
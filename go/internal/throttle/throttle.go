@@ -0,0 +1,160 @@
+// Package throttle limits the bandwidth of the streams between SSH clients
+// and Gitaly with token buckets.
+package throttle
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+)
+
+type contextKey struct{}
+
+var (
+	// Overridden in tests
+	timeNow = time.Now
+	sleep   = time.Sleep
+)
+
+// Limit is the bandwidth allowed in each direction of a stream. A nil Limit,
+// or one without BytesPerSecond, doesn't throttle anything.
+type Limit struct {
+	BytesPerSecond int64
+	BurstBytes     int64
+}
+
+// NewLimit builds the limit of cfg, replacing its rate by override if GitLab
+// sent one. An override of 0 lifts the limit.
+func NewLimit(cfg *config.BandwidthLimitConfig, override *int64) *Limit {
+	limit := &Limit{BytesPerSecond: cfg.BytesPerSecond, BurstBytes: cfg.BurstBytes}
+	if override != nil {
+		limit.BytesPerSecond = *override
+	}
+
+	if limit.BurstBytes <= 0 {
+		limit.BurstBytes = limit.BytesPerSecond
+	}
+
+	return limit
+}
+
+func (l *Limit) Enabled() bool {
+	return l != nil && l.BytesPerSecond > 0
+}
+
+// NewContext carries limit to the Gitaly handlers
+func NewContext(ctx context.Context, limit *Limit) context.Context {
+	return context.WithValue(ctx, contextKey{}, limit)
+}
+
+func FromContext(ctx context.Context) *Limit {
+	limit, _ := ctx.Value(contextKey{}).(*Limit)
+
+	return limit
+}
+
+// Reader throttles what is read from r
+func (l *Limit) Reader(r io.Reader) io.Reader {
+	if !l.Enabled() {
+		return r
+	}
+
+	return &reader{r: r, bucket: newBucket(l)}
+}
+
+// Writer throttles what is written to w. Writes are passed on in order and
+// without buffering, so that the sideband packets of Git, progress included,
+// reach the client intact.
+func (l *Limit) Writer(w io.Writer) io.Writer {
+	if !l.Enabled() {
+		return w
+	}
+
+	return &writer{w: w, bucket: newBucket(l)}
+}
+
+type reader struct {
+	r      io.Reader
+	bucket *bucket
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.bucket.burst {
+		p = p[:r.bucket.burst]
+	}
+
+	n, err := r.r.Read(p)
+	r.bucket.take(n)
+
+	return n, err
+}
+
+type writer struct {
+	w      io.Writer
+	bucket *bucket
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		chunk := p
+		if int64(len(chunk)) > w.bucket.burst {
+			chunk = chunk[:w.bucket.burst]
+		}
+
+		w.bucket.take(len(chunk))
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
+
+// bucket lets tokens run into debt, and sleeps until it is paid back
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  int64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit *Limit) *bucket {
+	return &bucket{
+		rate:   float64(limit.BytesPerSecond),
+		burst:  limit.BurstBytes,
+		tokens: float64(limit.BurstBytes),
+		last:   timeNow(),
+	}
+}
+
+func (b *bucket) take(n int) {
+	if n <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := timeNow()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens < 0 {
+		sleep(time.Duration(-b.tokens / b.rate * float64(time.Second)))
+	}
+}
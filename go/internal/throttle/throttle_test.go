@@ -0,0 +1,104 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-shell/go/internal/config"
+)
+
+// fakeClock advances when the throttle sleeps
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) install() func() {
+	timeNow = func() time.Time { return c.now }
+	sleep = func(d time.Duration) {
+		c.now = c.now.Add(d)
+		c.slept += d
+	}
+
+	return func() {
+		timeNow = time.Now
+		sleep = time.Sleep
+	}
+}
+
+// chunkWriter records every write it gets
+type chunkWriter struct {
+	chunks []string
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.chunks = append(w.chunks, string(p))
+
+	return len(p), nil
+}
+
+func TestNewLimit(t *testing.T) {
+	cfg := &config.BandwidthLimitConfig{BytesPerSecond: 1000}
+	require.Equal(t, &Limit{BytesPerSecond: 1000, BurstBytes: 1000}, NewLimit(cfg, nil))
+
+	override := int64(500)
+	require.Equal(t, &Limit{BytesPerSecond: 500, BurstBytes: 500}, NewLimit(cfg, &override))
+
+	override = 0
+	require.False(t, NewLimit(cfg, &override).Enabled())
+	require.False(t, NewLimit(&config.BandwidthLimitConfig{}, nil).Enabled())
+}
+
+func TestWriter(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	defer clock.install()()
+
+	out := &chunkWriter{}
+	w := (&Limit{BytesPerSecond: 100, BurstBytes: 40}).Writer(out)
+
+	n, err := w.Write([]byte(strings.Repeat("a", 100)))
+	require.NoError(t, err)
+	require.Equal(t, 100, n)
+
+	// The first burst is free, the rest waits for its tokens
+	require.Equal(t, []string{strings.Repeat("a", 40), strings.Repeat("a", 40), strings.Repeat("a", 20)}, out.chunks)
+	require.Equal(t, 600*time.Millisecond, clock.slept)
+
+	// Tokens build up again while idle, up to the burst
+	clock.now = clock.now.Add(time.Minute)
+	clock.slept = 0
+	_, err = w.Write([]byte("0009done"))
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), clock.slept)
+}
+
+func TestReader(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	defer clock.install()()
+
+	r := (&Limit{BytesPerSecond: 50, BurstBytes: 50}).Reader(strings.NewReader(strings.Repeat("b", 150)))
+
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("b", 150), string(data))
+	require.Equal(t, 2*time.Second, clock.slept)
+}
+
+func TestWithoutLimit(t *testing.T) {
+	out := &bytes.Buffer{}
+	in := strings.NewReader("in")
+
+	var limit *Limit
+	require.True(t, limit.Writer(out) == out)
+	require.True(t, limit.Reader(in) == in)
+
+	limit = FromContext(NewContext(context.Background(), &Limit{}))
+	require.True(t, limit.Writer(out) == out)
+	require.Nil(t, FromContext(context.Background()))
+}
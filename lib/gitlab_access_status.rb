@@ -5,12 +5,13 @@ class GitAccessStatus
 
   attr_reader :message, :gl_repository, :gl_project_path, :gl_id, :gl_username,
               :gitaly, :git_protocol, :git_config_options, :payload,
-              :gl_console_messages
+              :gl_console_messages, :bandwidth_limit
 
   def initialize(status, status_code, message, gl_repository: nil,
                  gl_project_path: nil, gl_id: nil,
                  gl_username: nil, gitaly: nil, git_protocol: nil,
-                 git_config_options: nil, payload: nil, gl_console_messages: [])
+                 git_config_options: nil, payload: nil, gl_console_messages: [],
+                 bandwidth_limit: nil)
     @status = status
     @status_code = status_code
     @message = message
@@ -23,6 +24,7 @@ class GitAccessStatus
     @git_protocol = git_protocol
     @payload = payload
     @gl_console_messages = gl_console_messages
+    @bandwidth_limit = bandwidth_limit
   end
 
   def self.create_from_json(json, status_code)
@@ -38,7 +40,8 @@ class GitAccessStatus
         gitaly: values["gitaly"],
         git_protocol: values["git_protocol"],
         payload: values["payload"],
-        gl_console_messages: values["gl_console_messages"])
+        gl_console_messages: values["gl_console_messages"],
+        bandwidth_limit: values["bandwidth_limit"])
   end
 
   def allowed?
@@ -65,6 +65,7 @@ class GitlabShell # rubocop:disable Metrics/ClassLength
       @gitaly = access_status.gitaly
       @username = access_status.gl_username
       @git_config_options = access_status.git_config_options
+      @bandwidth_limit = access_status.bandwidth_limit
       @gl_id = access_status.gl_id if defined?(@who)
 
       write_stderr(access_status.gl_console_messages)
@@ -170,7 +171,7 @@ class GitlabShell # rubocop:disable Metrics/ClassLength
 
     # TODO: instead of building from pieces here in gitlab-shell, build the
     # entire gitaly_request in gitlab-ce and pass on as-is here.
-    args = JSON.dump(
+    request = {
       'repository' => @gitaly['repository'],
       'gl_repository' => @gl_repository,
       'gl_project_path' => @gl_project_path,
@@ -178,7 +179,10 @@ class GitlabShell # rubocop:disable Metrics/ClassLength
       'gl_username' => @username,
       'git_config_options' => @git_config_options,
       'git_protocol' => @git_protocol
-    )
+    }
+    # Overrides bandwidth_limit of config.yml for this user or key
+    request['bandwidth_limit'] = @bandwidth_limit unless @bandwidth_limit.nil?
+    args = JSON.dump(request)
 
     gitaly_address = @gitaly['address']
     executable = GITALY_COMMANDS.fetch(@command)
@@ -191,7 +195,8 @@ class GitlabShell # rubocop:disable Metrics/ClassLength
 
   # This method is not covered by Rspec because it ends the current Ruby process.
   def exec_cmd(executable, gitaly_address:, token:, json_args:)
-    env = { 'GITALY_TOKEN' => token }
+    # SSH_CONNECTION lets the Gitaly command log the client IP in its summary
+    env = { 'GITALY_TOKEN' => token, 'SSH_CONNECTION' => ENV['SSH_CONNECTION'] }
 
     args = [executable, gitaly_address, json_args]
     # We use 'chdir: ROOT_PATH' to let the next executable know where config.yml is.
@@ -21,54 +21,74 @@ describe 'bin/gitlab-shell-authorized-keys-check' do
     end
   end
 
-  before(:all) do
-    write_config(
-      "gitlab_url" => "http+unix://#{CGI.escape(tmp_socket_path)}",
-    )
-  end
-
   let(:authorized_keys_check_path) { File.join(tmp_root_path, 'bin', 'gitlab-shell-authorized-keys-check') }
 
-  it 'succeeds when a valid key is given' do
-    output, status = run!
+  shared_examples 'authorized keys check' do
+    it 'succeeds when a valid key is given' do
+      output, status = run!
 
-    expect(output).to eq("command=\"#{gitlab_shell_path} key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty known-rsa-key\n")
-    expect(status).to be_success
-  end
+      expect(output).to eq("command=\"#{gitlab_shell_path} key-1\",no-port-forwarding,no-X11-forwarding,no-agent-forwarding,no-pty known-rsa-key\n")
+      expect(status).to be_success
+    end
 
-  it 'returns nothing when an unknown key is given' do
-    output, status = run!(key: 'unknown-key')
+    it 'returns nothing when an unknown key is given' do
+      output, status = run!(key: 'unknown-key')
 
-    expect(output).to eq("# No key was found for unknown-key\n")
-    expect(status).to be_success
-  end
+      expect(output).to eq("# No key was found for unknown-key\n")
+      expect(status).to be_success
+    end
 
-  it' fails when not enough arguments are given' do
-    output, status = run!(key: nil)
+    it' fails when not enough arguments are given' do
+      output, status = run!(key: nil)
 
-    expect(output).to eq('')
-    expect(status).not_to be_success
-  end
+      expect(output).to eq('')
+      expect(status).not_to be_success
+    end
 
-  it' fails when too many arguments are given' do
-    output, status = run!(key: ['a', 'b'])
+    it' fails when too many arguments are given' do
+      output, status = run!(key: ['a', 'b'])
 
-    expect(output).to eq('')
-    expect(status).not_to be_success
+      expect(output).to eq('')
+      expect(status).not_to be_success
+    end
+
+    it 'skips when run as the wrong user' do
+      output, status = run!(expected_user: 'unknown-user')
+
+      expect(output).to eq('')
+      expect(status).to be_success
+    end
+
+    it 'skips when the wrong users connects' do
+      output, status = run!(actual_user: 'unknown-user')
+
+      expect(output).to eq('')
+      expect(status).to be_success
+    end
   end
 
-  it 'skips when run as the wrong user' do
-    output, status = run!(expected_user: 'unknown-user')
+  describe 'without go features' do
+    before(:all) do
+      write_config(
+        "gitlab_url" => "http+unix://#{CGI.escape(tmp_socket_path)}",
+      )
+    end
 
-    expect(output).to eq('')
-    expect(status).to be_success
+    it_behaves_like 'authorized keys check'
   end
 
-  it 'skips when the wrong users connects' do
-    output, status = run!(actual_user: 'unknown-user')
+  describe 'with the go authorized keys check feature' do
+    before(:all) do
+      write_config(
+        'gitlab_url' => "http+unix://#{CGI.escape(tmp_socket_path)}",
+        'migration' => {
+          'enabled' => true,
+          'features' => ['gitlab-shell-authorized-keys-check']
+        }
+      )
+    end
 
-    expect(output).to eq('')
-    expect(status).to be_success
+    it_behaves_like 'authorized keys check'
   end
 
   def run!(expected_user: 'git', actual_user: 'git', key: 'known-rsa-key')
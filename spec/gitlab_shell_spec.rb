@@ -240,6 +240,37 @@ describe GitlabShell do
       end
     end
 
+    context 'gitaly-upload-pack with a bandwidth limit override' do
+      let(:ssh_cmd) { "git-upload-pack gitlab-ci.git" }
+      let(:gitaly_message_with_limit) do
+        JSON.dump(JSON.parse(gitaly_message).merge('bandwidth_limit' => 1024))
+      end
+
+      before do
+        allow(api).to receive(:check_access).and_return(
+          GitAccessStatus.new(
+            true,
+            '200',
+            'ok',
+            gl_repository: gl_repository,
+            gl_project_path: gl_project_path,
+            gl_id: gl_id,
+            gl_username: gl_username,
+            git_config_options: git_config_options,
+            gitaly: { 'repository' => { 'relative_path' => repo_name, 'storage_name' => 'default'} , 'address' => 'unix:gitaly.socket' },
+            git_protocol: git_protocol,
+            bandwidth_limit: 1024
+          )
+        )
+      end
+
+      after { subject.exec(ssh_cmd) }
+
+      it "should pass the override on to the command" do
+        expect(subject).to receive(:exec_cmd).with(File.join(ROOT_PATH, "bin/gitaly-upload-pack"), gitaly_address: 'unix:gitaly.socket', json_args: gitaly_message_with_limit, token: nil)
+      end
+    end
+
     context 'git-receive-pack' do
       let(:ssh_cmd) { "git-receive-pack gitlab-ci.git" }
 